@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strings"
+	"time"
+)
+
+const adminTimeout = 5 * time.Second
+
+var errRoomGone = errors.New("room is gone")
+
+type RoomSummary struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+	Map   string `json:"map"`
+	Game  int    `json:"game"`
+	// zero when no game has started yet
+	Turn int `json:"turn"`
+	// per seat, a disconnected player may still hold the seat
+	Connected  []bool `json:"connected"`
+	Spectators int    `json:"spectators"`
+}
+
+func (r *Room) phase() string {
+	switch r.state {
+	case r.waitingForP1, r.waitingForP2:
+		return "waiting"
+	case r.running:
+		return "running"
+	case r.postGame:
+		return "post_game"
+	default:
+		return "closing"
+	}
+}
+
+func (r *Room) summary() RoomSummary {
+	s := RoomSummary{
+		Code:       r.code,
+		State:      r.phase(),
+		Map:        r.gameConfig.name,
+		Game:       r.series.game + 1,
+		Connected:  []bool{r.player1chans.read != nil, r.player2chans.read != nil},
+		Spectators: len(r.spectators),
+	}
+	if r.gamestate != nil {
+		s.Turn = r.gamestate.turn
+	}
+	return s
+}
+
+// Summary asks the room goroutine for a summary, it fails once the room is
+// gone.
+func (r *Room) Summary(ctx context.Context) (RoomSummary, error) {
+	reply := make(chan RoomSummary, 1)
+	select {
+	case r.summaries <- reply:
+		return <-reply, nil
+	case <-r.done:
+		return RoomSummary{}, errRoomGone
+	case <-ctx.Done():
+		return RoomSummary{}, ctx.Err()
+	}
+}
+
+func (r *Room) Dump(ctx context.Context) (RoomDump, error) {
+	reply := make(chan RoomDump, 1)
+	select {
+	case r.dumps <- reply:
+		return <-reply, nil
+	case <-r.done:
+		return RoomDump{}, errRoomGone
+	case <-ctx.Done():
+		return RoomDump{}, ctx.Err()
+	}
+}
+
+// ForceClose closes the room sending reason to both players, a running game
+// ends without a result.
+func (r *Room) ForceClose(ctx context.Context, reason string) error {
+	select {
+	case r.adminCloses <- reason:
+		return nil
+	case <-r.done:
+		return errRoomGone
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewAdminHandler serves the admin API and pprof, every request needs the
+// token as a bearer token.
+func NewAdminHandler(hub *Hub, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/rooms", func(w http.ResponseWriter, r *http.Request) {
+		adminListRooms(hub, w, r)
+	})
+	mux.HandleFunc("GET /admin/rooms/{code}", func(w http.ResponseWriter, r *http.Request) {
+		adminDumpRoom(hub, w, r)
+	})
+	mux.HandleFunc("POST /admin/rooms/{code}/close", func(w http.ResponseWriter, r *http.Request) {
+		adminCloseRoom(hub, w, r)
+	})
+	mux.HandleFunc("POST /admin/broadcast", func(w http.ResponseWriter, r *http.Request) {
+		adminBroadcast(hub, w, r)
+	})
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAdminError(w, http.StatusUnauthorized, "missing or wrong token")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Println("admin:", err)
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, status int, msg string) {
+	writeAdminJSON(w, status, map[string]string{"error": msg})
+}
+
+// adminRoom finds the room named in the path, writing the error response
+// when there is none.
+func adminRoom(ctx context.Context, hub *Hub, w http.ResponseWriter, r *http.Request) (*Room, bool) {
+	rooms, err := hub.Rooms(ctx, r.PathValue("code"))
+	if err != nil {
+		writeAdminError(w, http.StatusServiceUnavailable, err.Error())
+		return nil, false
+	}
+	if len(rooms) == 0 {
+		writeAdminError(w, http.StatusNotFound, "room doesnt exist")
+		return nil, false
+	}
+	return rooms[0], true
+}
+
+func adminListRooms(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), adminTimeout)
+	defer cancel()
+
+	rooms, err := hub.Rooms(ctx, "")
+	if err != nil {
+		writeAdminError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	summaries := []RoomSummary{}
+	for _, room := range rooms {
+		summary, err := room.Summary(ctx)
+		if errors.Is(err, errRoomGone) {
+			continue
+		}
+		if err != nil {
+			writeAdminError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Code < summaries[j].Code
+	})
+	writeAdminJSON(w, http.StatusOK, summaries)
+}
+
+func adminDumpRoom(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), adminTimeout)
+	defer cancel()
+
+	room, ok := adminRoom(ctx, hub, w, r)
+	if !ok {
+		return
+	}
+	dump, err := room.Dump(ctx)
+	if errors.Is(err, errRoomGone) {
+		writeAdminError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeAdminError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, dump)
+}
+
+func adminCloseRoom(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), adminTimeout)
+	defer cancel()
+
+	body := struct {
+		Reason string `json:"reason"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if reason == "" {
+		reason = "room closed by the operators"
+	}
+
+	room, ok := adminRoom(ctx, hub, w, r)
+	if !ok {
+		return
+	}
+	err := room.ForceClose(ctx, reason)
+	if errors.Is(err, errRoomGone) {
+		writeAdminError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeAdminError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminBroadcast(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), adminTimeout)
+	defer cancel()
+
+	body := struct {
+		Text string `json:"text"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if strings.TrimSpace(body.Text) == "" {
+		writeAdminError(w, http.StatusBadRequest, "text cant be empty")
+		return
+	}
+	if err := hub.Broadcast(ctx, body.Text); err != nil {
+		writeAdminError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,304 @@
+package main
+
+import "sort"
+
+const botOutboxSize = 8
+
+// Bot takes a seat like a Player does, it only knows what the room sends it so
+// it plays under the same fog of war as a human.
+type Bot struct {
+	chans  RoomChans
+	outbox chan PlayerMessage
+	done   chan struct{}
+
+	cfg     ClientConfig
+	hexes   map[Vector]bool
+	sites   map[Vector]bool
+	terrain map[Vector]TerrainType
+	classes map[int]TankClass
+	tanks   map[int]Vector
+	enemies map[int]Vector
+	radius  int
+}
+
+func NewBot() *Bot {
+	return &Bot{
+		chans: RoomChans{
+			read: make(chan RoomMessage),
+			send: make(chan PlayerMessage),
+		},
+		outbox: make(chan PlayerMessage, botOutboxSize),
+		done:   make(chan struct{}),
+	}
+}
+
+func (b *Bot) Run() {
+	go b.writePump()
+	defer close(b.done)
+
+	for rm := range b.chans.read {
+		switch rm.msgType {
+		case RoomGameStarted:
+			b.reset(rm.config)
+			b.sendTurn()
+		case RoomTurnResult:
+			b.apply(rm.turnResults)
+			b.sendTurn()
+		case RoomGameFinished:
+			b.outbox <- PlayerMessage{msgType: PlayerRematch}
+		}
+	}
+}
+
+// writePump keeps messages in order without ever blocking the room, which
+// may be busy sending to the bot.
+func (b *Bot) writePump() {
+	for {
+		select {
+		case msg := <-b.outbox:
+			select {
+			case b.chans.send <- msg:
+			case <-b.done:
+				return
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *Bot) sendTurn() {
+	if len(b.tanks) == 0 {
+		return
+	}
+	b.outbox <- PlayerMessage{msgType: PlayerSendTurn, tankActions: b.actions()}
+}
+
+func (b *Bot) reset(cfg ClientConfig) {
+	b.cfg = cfg
+	b.hexes = make(map[Vector]bool)
+	b.sites = make(map[Vector]bool)
+	b.classes = make(map[int]TankClass)
+	b.tanks = make(map[int]Vector)
+	b.enemies = make(map[int]Vector)
+	b.radius = 0
+
+	for _, h := range cfg.Hexes {
+		b.hexes[h.P] = true
+		b.radius = max(b.radius, h.P.distance(cfg.Center))
+	}
+	for _, s := range cfg.Sites {
+		b.sites[s.P] = true
+	}
+	b.terrain = terrainByHex(cfg.Hexes, cfg.Terrain)
+	for _, t := range append(append([]TankConfig{}, cfg.PlayerTanks...), cfg.EnemyTanks...) {
+		b.classes[t.Id] = cfg.tankClass(t)
+	}
+	for _, t := range cfg.PlayerTanks {
+		b.tanks[t.Id] = t.P
+	}
+	for _, e := range cfg.EnemyTanks {
+		for _, t := range cfg.PlayerTanks {
+			visibilityRange := b.classes[t.Id].VisibilityRange - b.terrain[e.P].Concealment
+			if cfg.Visibility.sees(t.P, e.P, visibilityRange, b.blocksSight) {
+				b.enemies[e.Id] = e.P
+			}
+		}
+	}
+}
+
+func (b *Bot) apply(results []TurnResult) {
+	for _, res := range results {
+		switch res := res.(type) {
+		case TurnResultMove2:
+			b.moveTank(res.Id, res.P2)
+		case TurnResultMove3:
+			b.moveTank(res.Id, res.P2)
+		case TurnResultExplosion:
+			if res.Destroyed {
+				delete(b.tanks, res.Id)
+				delete(b.enemies, res.Id)
+			}
+		case TurnResultDestroyed:
+			delete(b.enemies, res.Id)
+		case TurnResultVisible:
+			if res.Visible {
+				b.enemies[res.Id] = res.P
+			} else {
+				delete(b.enemies, res.Id)
+			}
+		case TurnResultShrink:
+			if !res.Started {
+				b.radius = res.R
+				break
+			}
+			for p := range b.hexes {
+				if p.distance(b.cfg.Center) >= res.R {
+					delete(b.hexes, p)
+				}
+			}
+			b.radius = res.R - 1
+		}
+	}
+}
+
+func (b *Bot) moveTank(id int, p Vector) {
+	if _, ok := b.tanks[id]; ok {
+		b.tanks[id] = p
+		return
+	}
+	b.enemies[id] = p
+}
+
+// actions fires at any enemy in a straight line, then lobs shells at known
+// enemies in indirect range, otherwise it closes in on the nearest known
+// enemy, or the center, without leaving the safe zone.
+func (b *Bot) actions() []TankAction {
+	ids := make([]int, 0, len(b.tanks))
+	for id := range b.tanks {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	occupied := make(map[Vector]bool)
+	for _, p := range b.tanks {
+		occupied[p] = true
+	}
+	for _, p := range b.enemies {
+		occupied[p] = true
+	}
+
+	actions := []TankAction{}
+	for _, id := range ids {
+		p := b.tanks[id]
+		class := b.classes[id]
+		if dir, ok := b.fireDirection(p, class.FireRange, occupied); ok {
+			actions = append(actions, TankAction{Type: TankFire, Id: id, Dir: dir})
+			continue
+		}
+		if target, ok := b.indirectTarget(p, class); ok {
+			actions = append(actions, TankAction{Type: TankIndirectFire, Id: id, Target: target})
+			continue
+		}
+		path := b.path(p, class.DriveRange, occupied)
+		if len(path) < 2 {
+			continue
+		}
+		delete(occupied, p)
+		occupied[path[len(path)-1]] = true
+		actions = append(actions, TankAction{Type: TankMove, Id: id, Path: path})
+	}
+	return actions
+}
+
+func (b *Bot) fireDirection(p Vector, fireRange int, occupied map[Vector]bool) (Vector, bool) {
+	for _, dir := range unitVectors {
+		cur := p
+		for range fireRange {
+			cur = cur.add(dir)
+			if b.sites[cur] {
+				break
+			}
+			if !occupied[cur] {
+				continue
+			}
+			if b.isEnemyAt(cur) {
+				return dir, true
+			}
+			break
+		}
+	}
+	return Vector{}, false
+}
+
+// indirectTarget picks the nearest known enemy within indirect range.
+func (b *Bot) indirectTarget(p Vector, class TankClass) (Vector, bool) {
+	target, best := Vector{}, -1
+	for _, e := range b.enemies {
+		d := e.distance(p)
+		if d < class.IndirectMinRange || d > class.IndirectMaxRange {
+			continue
+		}
+		if best < 0 || d < best || d == best && (e.X < target.X || e.X == target.X && e.Y < target.Y) {
+			target, best = e, d
+		}
+	}
+	return target, best >= 0
+}
+
+func (b *Bot) isEnemyAt(p Vector) bool {
+	for _, e := range b.enemies {
+		if e == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Bot) blocksSight(p Vector) bool {
+	return b.sites[p] || b.terrain[p].BlocksSight
+}
+
+func (b *Bot) target(from Vector) Vector {
+	target := b.cfg.Center
+	best := -1
+	for _, e := range b.enemies {
+		if d := e.distance(from); best < 0 || d < best {
+			target, best = e, d
+		}
+	}
+	return target
+}
+
+func (b *Bot) safe(p Vector) bool {
+	return p.distance(b.cfg.Center) < b.radius-1
+}
+
+// path picks the reachable hex that is safe and closest to the target, ties
+// are broken by cheaper paths.
+func (b *Bot) path(from Vector, driveRange int, occupied map[Vector]bool) []Vector {
+	target := b.target(from)
+	prev := map[Vector]Vector{from: from}
+	costs := map[Vector]int{from: 0}
+	frontier := []Vector{from}
+	best := from
+
+	score := func(p Vector) int {
+		s := p.distance(target)
+		if p == target {
+			s = 1
+		}
+		if !b.safe(p) {
+			s += 100
+		}
+		return s
+	}
+
+	for len(frontier) > 0 {
+		cur := frontier[0]
+		frontier = frontier[1:]
+		if score(cur) < score(best) || score(cur) == score(best) && costs[cur] < costs[best] {
+			best = cur
+		}
+		for _, dir := range unitVectors {
+			next := cur.add(dir)
+			if !b.hexes[next] || b.sites[next] || b.terrain[next].Impassable || occupied[next] {
+				continue
+			}
+			cost := costs[cur] + b.terrain[next].Cost
+			if known, ok := costs[next]; cost > driveRange || ok && known <= cost {
+				continue
+			}
+			prev[next] = cur
+			costs[next] = cost
+			frontier = append(frontier, next)
+		}
+	}
+
+	path := []Vector{best}
+	for cur := best; cur != from; {
+		cur = prev[cur]
+		path = append([]Vector{cur}, path...)
+	}
+	return path
+}
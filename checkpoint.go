@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const CheckpointVersion = 1
+
+type SeatCheckpoint struct {
+	Token    string `json:"token"`
+	Timeouts int    `json:"timeouts"`
+	// every turn sent to the seat, a reconnecting client rebuilds its game
+	// from them
+	Results []json.RawMessage `json:"results"`
+}
+
+// RoomCheckpoint is a running game stopped by a shutdown, it holds what the
+// room needs to carry on with the same seats.
+type RoomCheckpoint struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	Code    string    `json:"code"`
+	// the map the room was opened with, before the players swap sides
+	Map              MapConfig         `json:"map"`
+	Options          RoomOptions       `json:"options"`
+	Series           SeriesStatus      `json:"series"`
+	Seats            []SeatCheckpoint  `json:"seats"`
+	SpectatorResults []json.RawMessage `json:"spectatorResults"`
+	Game             GameStateSnapshot `json:"game"`
+	// the game recorded so far, nil when replays are off
+	Replay *Replay `json:"replay,omitempty"`
+
+	// the file the checkpoint was loaded from
+	path string
+}
+
+func (r *Room) checkpoint() (RoomCheckpoint, error) {
+	cp := RoomCheckpoint{
+		Version: CheckpointVersion,
+		Time:    time.Now().UTC(),
+		Code:    r.code,
+		Map:     r.gameConfig.MapConfig(),
+		Options: r.options,
+		Series:  r.series.status(true),
+		Game:    r.gamestate.Snapshot(),
+		Replay:  r.replay,
+	}
+	for _, isP1 := range []bool{true, false} {
+		_, seat := r.playerChans(isP1)
+		results, err := marshalTurns(seat.results)
+		if err != nil {
+			return cp, err
+		}
+		cp.Seats = append(cp.Seats, SeatCheckpoint{seat.token, seat.timeouts, results})
+	}
+	spectatorResults, err := marshalTurns(r.spectatorResults)
+	if err != nil {
+		return cp, err
+	}
+	cp.SpectatorResults = spectatorResults
+	return cp, nil
+}
+
+func marshalTurns(turns [][]TurnResult) ([]json.RawMessage, error) {
+	raw := []json.RawMessage{}
+	for _, results := range turns {
+		data, err := json.Marshal(results)
+		if err != nil {
+			return nil, err
+		}
+		raw = append(raw, data)
+	}
+	return raw, nil
+}
+
+// saveCheckpoint keeps the running game for after the restart, in a file when
+// a checkpoint directory is set and on stdout otherwise.
+func (r *Room) saveCheckpoint() {
+	defer func() {
+		if v := recover(); v != nil {
+			fmt.Println("room: checkpoint failed:", v)
+		}
+	}()
+
+	cp, err := r.checkpoint()
+	if err != nil {
+		fmt.Println("room: checkpoint failed:", err)
+		return
+	}
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		fmt.Println("room: checkpoint failed:", err)
+		return
+	}
+	if r.settings.checkpointDir == "" {
+		fmt.Println(string(data))
+		return
+	}
+	name := fmt.Sprintf("checkpoint-%d.json", time.Now().UnixNano())
+	path := filepath.Join(r.settings.checkpointDir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		fmt.Println("room: checkpoint failed:", err)
+		return
+	}
+	fmt.Printf("room %s: checkpoint saved: %s\n", r.code, path)
+}
+
+// recordedResult is a turn result restored from a checkpoint, it is sent on
+// exactly as it was recorded.
+type recordedResult json.RawMessage
+
+func (r recordedResult) MarshalJSON() ([]byte, error) {
+	return r, nil
+}
+
+func (r recordedResult) isTurnResult() {}
+
+func unmarshalTurns(raw []json.RawMessage) ([][]TurnResult, error) {
+	turns := [][]TurnResult{}
+	for _, data := range raw {
+		var results []json.RawMessage
+		if err := json.Unmarshal(data, &results); err != nil {
+			return nil, err
+		}
+		turn := []TurnResult{}
+		for _, res := range results {
+			turn = append(turn, recordedResult(res))
+		}
+		turns = append(turns, turn)
+	}
+	return turns, nil
+}
+
+// LoadCheckpoints reads the checkpoints in dir. The files stay until the hub
+// has tried to resume them, see retireCheckpoint. Files that cant be read are
+// reported and left alone, files that cant be parsed are retired as failed.
+func LoadCheckpoints(dir string) ([]RoomCheckpoint, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "checkpoint-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := []RoomCheckpoint{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Println("checkpoints:", err)
+			continue
+		}
+		cp := RoomCheckpoint{path: path}
+		if err := json.Unmarshal(data, &cp); err != nil {
+			fmt.Printf("checkpoints: %s: %v\n", path, err)
+			retireCheckpoint(path, false)
+			continue
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, nil
+}
+
+// retireCheckpoint renames a checkpoint file once it was tried, so a game is
+// resumed at most once and the file is still around to look into.
+func retireCheckpoint(path string, resumed bool) {
+	if path == "" {
+		return
+	}
+	suffix := ".failed"
+	if resumed {
+		suffix = ".resumed"
+	}
+	if err := os.Rename(path, path+suffix); err != nil {
+		fmt.Println("checkpoints:", err)
+	}
+}
+
+// ResumeRoom rebuilds a room from a checkpoint with both seats held, players
+// take them back by reconnecting with their tokens.
+func ResumeRoom(cp RoomCheckpoint, settings RoomSettings, close chan *Room) (*Room, error) {
+	if cp.Version != CheckpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d", cp.Version)
+	}
+	if settings.reconnectGrace <= 0 {
+		return nil, errors.New("seats cant be held without a reconnect grace")
+	}
+	if len(cp.Seats) != 2 {
+		return nil, fmt.Errorf("checkpoint has %d seats", len(cp.Seats))
+	}
+	gc, err := cp.Map.GameConfig()
+	if err != nil {
+		return nil, err
+	}
+	gs, err := RestoreGameState(cp.Game)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewRoom(cp.Code, settings, gc, close)
+	r.options = cp.Options.normalized()
+	r.series = Series{
+		bestOf: cp.Series.BestOf,
+		game:   cp.Series.Game,
+		winsP1: cp.Series.Wins,
+		winsP2: cp.Series.Losses,
+		draws:  cp.Series.Draws,
+	}
+	r.gamestate = gs
+	if settings.replayDir != "" {
+		r.replay = cp.Replay
+	}
+	for i, isP1 := range []bool{true, false} {
+		results, err := unmarshalTurns(cp.Seats[i].Results)
+		if err != nil {
+			return nil, err
+		}
+		_, seat := r.playerChans(isP1)
+		*seat = Seat{
+			token:     cp.Seats[i].Token,
+			results:   results,
+			timeouts:  cp.Seats[i].Timeouts,
+			reconnect: time.NewTimer(settings.reconnectGrace),
+		}
+	}
+	if r.spectatorResults, err = unmarshalTurns(cp.SpectatorResults); err != nil {
+		return nil, err
+	}
+	r.startTurnTimer()
+	r.setState(r.running)
+	return r, nil
+}
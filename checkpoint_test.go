@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResumedRoomWithoutReconnects(t *testing.T) {
+	gc := NewBasicConfig(false, true)
+	cp := RoomCheckpoint{
+		Version: CheckpointVersion,
+		Code:    "resumed",
+		Map:     gc.MapConfig(),
+		Series:  newSeries(3).status(true),
+		Seats:   []SeatCheckpoint{{Token: "p1"}, {Token: "p2"}},
+		Game:    NewGameState(gc).Snapshot(),
+	}
+	settings := NewDefaultRoomSettings()
+	settings.reconnectGrace = 10 * time.Millisecond
+	closeReq := make(chan *Room)
+	r, err := ResumeRoom(cp, settings, closeReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.Run()
+
+	select {
+	case closed := <-closeReq:
+		if closed != r {
+			t.Fatal("close requested for another room")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("room stayed open with both seats expired")
+	}
+	close(r.requests)
+	<-r.done
+
+	// neither absent player wins the game or the series
+	if r.series.winsP1 != 0 || r.series.winsP2 != 0 || r.series.draws != 0 {
+		t.Errorf("series recorded a result: %+v", r.series)
+	}
+	if r.series.game != 0 {
+		t.Errorf("series moved on to game %d", r.series.game+1)
+	}
+}
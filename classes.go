@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TankClass gives a tank its ranges and toughness, a TankConfig picks one by
+// name.
+type TankClass struct {
+	Name            string `json:"name"`
+	DriveRange      int    `json:"driveRange"`
+	VisibilityRange int    `json:"visibilityRange"`
+	FireRange       int    `json:"fireRange"`
+	HP              int    `json:"hp"`
+	Armor           int    `json:"armor,omitempty"`
+	// hexes indirect fire can reach, a zero max leaves the class without it
+	IndirectMinRange int `json:"indirectMinRange,omitempty"`
+	IndirectMaxRange int `json:"indirectMaxRange,omitempty"`
+	// dealt by indirect fire to the tanks next to the impact, armor counts
+	SplashDamage int `json:"splashDamage,omitempty"`
+	// indirect fire lands at the start of the next turn
+	IndirectDelayed bool `json:"indirectDelayed,omitempty"`
+}
+
+// DefaultTankClasses can be used by every map without listing them, a map
+// class of the same name replaces the default one.
+var DefaultTankClasses = []TankClass{
+	{Name: "scout", DriveRange: 7, VisibilityRange: 4, FireRange: 2, HP: 2},
+	{Name: "main_battle_tank", DriveRange: 5, VisibilityRange: 3, FireRange: 3, HP: 4, Armor: 1},
+	{
+		Name: "artillery", DriveRange: 3, VisibilityRange: 2, FireRange: 5, HP: 2,
+		IndirectMinRange: 2, IndirectMaxRange: 6, SplashDamage: 1, IndirectDelayed: true,
+	},
+	{Name: "tank_destroyer", DriveRange: 4, VisibilityRange: 2, FireRange: 4, HP: 3, Armor: 2},
+}
+
+// resolveClasses returns the classes of a map, its own ones followed by the
+// default ones its tanks use, so the map no longer depends on the defaults.
+func resolveClasses(own []TankClass, tanks []TankConfig) []TankClass {
+	classes := append([]TankClass{}, own...)
+	for _, t := range tanks {
+		if t.Class == "" || findClass(classes, t.Class) != nil {
+			continue
+		}
+		if c := findClass(DefaultTankClasses, t.Class); c != nil {
+			classes = append(classes, *c)
+		}
+	}
+	return classes
+}
+
+func findClass(classes []TankClass, name string) *TankClass {
+	for i := range classes {
+		if classes[i].Name == name {
+			return &classes[i]
+		}
+	}
+	return nil
+}
+
+// resolveTankClass works out what a tank can do. Tanks without a class get
+// the ranges of base, hp and armor set on the tank win over its class.
+func resolveTankClass(tc TankConfig, classes []TankClass, base TankClass) TankClass {
+	class := base
+	if c := findClass(classes, tc.Class); c != nil {
+		class = *c
+	}
+	if tc.HP != nil {
+		class.HP = *tc.HP
+	}
+	if tc.Armor != nil {
+		class.Armor = *tc.Armor
+	}
+	return class
+}
+
+func (gc GameConfig) tankClass(tc TankConfig) TankClass {
+	base := TankClass{
+		DriveRange:      gc.driveRange,
+		VisibilityRange: gc.visibilityRange,
+		FireRange:       gc.fireRange,
+		HP:              1,
+	}
+	return resolveTankClass(tc, gc.classes, base)
+}
+
+func (cc ClientConfig) tankClass(tc TankConfig) TankClass {
+	base := TankClass{
+		DriveRange:      cc.DriveRange,
+		VisibilityRange: cc.VisibilityRange,
+		FireRange:       cc.FireRange,
+		HP:              1,
+	}
+	return resolveTankClass(tc, cc.Classes, base)
+}
+
+// minVisibilityRange is the shortest sight of any tank on the map.
+func (gc GameConfig) minVisibilityRange() int {
+	shortest := gc.visibilityRange
+	for _, t := range append(append([]TankConfig{}, gc.tanksP1...), gc.tanksP2...) {
+		shortest = min(shortest, gc.tankClass(t).VisibilityRange)
+	}
+	return shortest
+}
+
+func (gc GameConfig) validateClasses() []error {
+	errs := []error{}
+	names := make(map[string]bool)
+	for _, c := range gc.classes {
+		if c.Name == "" {
+			errs = append(errs, errors.New("tank class needs a name"))
+		}
+		if names[c.Name] {
+			errs = append(errs, fmt.Errorf("tank class %q listed twice", c.Name))
+		}
+		names[c.Name] = true
+		if c.DriveRange < 1 || c.VisibilityRange < 1 || c.FireRange < 1 {
+			errs = append(errs, fmt.Errorf("tank class %q needs positive ranges", c.Name))
+		}
+		if c.HP < 1 || c.Armor < 0 {
+			errs = append(errs, fmt.Errorf("tank class %q needs positive hp and no negative armor", c.Name))
+		}
+		if c.IndirectMaxRange < 0 || c.SplashDamage < 0 ||
+			c.IndirectMaxRange > 0 && (c.IndirectMinRange < 1 || c.IndirectMinRange > c.IndirectMaxRange) {
+			errs = append(errs, fmt.Errorf("tank class %q needs an indirect fire range from 1 up and no negative splash", c.Name))
+		}
+	}
+	for _, t := range append(append([]TankConfig{}, gc.tanksP1...), gc.tanksP2...) {
+		if t.Class != "" && !names[t.Class] {
+			errs = append(errs, fmt.Errorf("tank %d has unknown class %q", t.Id, t.Class))
+		}
+	}
+	return errs
+}
@@ -3,6 +3,14 @@ package main
 type TankConfig struct {
 	Id int    `json:"id"`
 	P  Vector `json:"p"`
+	// empty uses the ranges of the map
+	Class string `json:"class,omitempty"`
+	// left out takes the hp of the class, a tank without class is destroyed
+	// by its first hit
+	HP *int `json:"hp,omitempty"`
+	// taken off the damage of every hit, left out takes the armor of the
+	// class
+	Armor *int `json:"armor,omitempty"`
 }
 
 type SceneConfig struct {
@@ -11,17 +19,24 @@ type SceneConfig struct {
 }
 
 type ClientConfig struct {
-	PlayerTanks     []TankConfig  `json:"playerTanks"`
-	EnemyTanks      []TankConfig  `json:"enemyTanks"`
-	Hexes           []SceneConfig `json:"hexes"`
-	Sites           []SceneConfig `json:"sites"`
-	DriveRange      int           `json:"driveRange"`
-	VisibilityRange int           `json:"visibilityRange"`
-	FireRange       int           `json:"fireRange"`
-	Center          Vector        `json:"center"`
+	Map             string          `json:"map"`
+	PlayerTanks     []TankConfig    `json:"playerTanks"`
+	EnemyTanks      []TankConfig    `json:"enemyTanks"`
+	Hexes           []SceneConfig   `json:"hexes"`
+	Sites           []SceneConfig   `json:"sites"`
+	DriveRange      int             `json:"driveRange"`
+	VisibilityRange int             `json:"visibilityRange"`
+	FireRange       int             `json:"fireRange"`
+	Center          Vector          `json:"center"`
+	Visibility      VisibilityModel `json:"visibility"`
+	Terrain         []TerrainType   `json:"terrain"`
+	Damage          int             `json:"damage"`
+	DamageFalloff   int             `json:"damageFalloff"`
+	Classes         []TankClass     `json:"classes"`
 }
 
 type GameConfig struct {
+	name            string
 	tanksP1         []TankConfig
 	tanksP2         []TankConfig
 	hexes           []SceneConfig
@@ -29,6 +44,11 @@ type GameConfig struct {
 	driveRange      int
 	visibilityRange int
 	fireRange       int
+	visibility      VisibilityModel
+	terrain         []TerrainType
+	damage          int
+	damageFalloff   int
+	classes         []TankClass
 	p1First         bool
 	center          Vector
 	shrinkAfter     int
@@ -38,6 +58,7 @@ type GameConfig struct {
 
 func (gc GameConfig) ClientConfigs() (ClientConfig, ClientConfig) {
 	p1 := ClientConfig{
+		gc.name,
 		gc.tanksP1,
 		gc.tanksP2,
 		gc.hexes,
@@ -46,8 +67,14 @@ func (gc GameConfig) ClientConfigs() (ClientConfig, ClientConfig) {
 		gc.visibilityRange,
 		gc.fireRange,
 		gc.center,
+		gc.visibility,
+		gc.terrain,
+		gc.damage,
+		gc.damageFalloff,
+		gc.classes,
 	}
 	p2 := ClientConfig{
+		gc.name,
 		gc.tanksP2,
 		gc.tanksP1,
 		gc.hexes,
@@ -56,19 +83,30 @@ func (gc GameConfig) ClientConfigs() (ClientConfig, ClientConfig) {
 		gc.visibilityRange,
 		gc.fireRange,
 		gc.center,
+		gc.visibility,
+		gc.terrain,
+		gc.damage,
+		gc.damageFalloff,
+		gc.classes,
 	}
 	return p1, p2
 }
 
+// damageAt is what a shell that travelled distance hexes does to a tank with
+// the given armor, a hit always takes at least one hit point.
+func (gc GameConfig) damageAt(distance, armor int) int {
+	return max(gc.damage-gc.damageFalloff*(distance-1)-armor, 1)
+}
+
 func NewBasicConfig(swapPlayers, p1First bool) GameConfig {
 	center := Vector{2, 1}
 	tanksP1 := []TankConfig{
-		{1, Vector{0, 0}},
-		{2, Vector{2, -2}},
+		{Id: 1, P: Vector{0, 0}},
+		{Id: 2, P: Vector{2, -2}},
 	}
 	tanksP2 := []TankConfig{
-		{3, Vector{-2, -1}},
-		{4, Vector{0, 1}},
+		{Id: 3, P: Vector{-2, -1}},
+		{Id: 4, P: Vector{0, 1}},
 	}
 	hexes := []SceneConfig{
 		{Vector{1, -2}, 2},
@@ -86,12 +124,16 @@ func NewBasicConfig(swapPlayers, p1First bool) GameConfig {
 		{Vector{-2, 2}, 0},
 		{Vector{-1, 2}, 0},
 	}
+	if swapPlayers {
+		tanksP1, tanksP2 = tanksP2, tanksP1
+	}
 	radius := 0
 	for _, h := range hexes {
 		radius = max(radius, h.P.distance(center))
 	}
 
 	return GameConfig{
+		name:    DefaultMapName,
 		tanksP1: tanksP1,
 		tanksP2: tanksP2,
 		hexes:   hexes,
@@ -102,6 +144,8 @@ func NewBasicConfig(swapPlayers, p1First bool) GameConfig {
 		driveRange:      5,
 		visibilityRange: 2,
 		fireRange:       3,
+		visibility:      VisibilityRange,
+		damage:          1,
 		p1First:         p1First,
 		center:          center,
 		shrinkAfter:     2,
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// InvariantError is an event a state machine should never see, it takes down
+// only the room or connection it happened in.
+type InvariantError struct {
+	State string
+	Event string
+}
+
+func (e InvariantError) Error() string {
+	return fmt.Sprintf("invariant violated in %s: %s", e.State, e.Event)
+}
+
+func newInvariantError(state any, event string) InvariantError {
+	return InvariantError{stateName(state), event}
+}
+
+// PanicError is a recovered panic and the stack it happened on.
+type PanicError struct {
+	Value any
+	Stack string
+}
+
+func (e PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+func newPanicError(v any) PanicError {
+	return PanicError{v, string(debug.Stack())}
+}
+
+func stateName(state any) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", state), "main.")
+}
+
+type SeatDump struct {
+	Connected bool         `json:"connected"`
+	Holding   bool         `json:"holding"`
+	Turns     int          `json:"turns"`
+	Timeouts  int          `json:"timeouts"`
+	Rematch   bool         `json:"rematch"`
+	Queued    bool         `json:"queued"`
+	Actions   []TankAction `json:"actions"`
+}
+
+type RoomDump struct {
+	Time       time.Time          `json:"time"`
+	Code       string             `json:"code"`
+	State      string             `json:"state"`
+	Error      string             `json:"error"`
+	Stack      string             `json:"stack,omitempty"`
+	Map        string             `json:"map"`
+	Options    RoomOptions        `json:"options"`
+	Series     SeriesStatus       `json:"series"`
+	Seats      []SeatDump         `json:"seats"`
+	Spectators int                `json:"spectators"`
+	Game       *GameStateSnapshot `json:"game"`
+}
+
+func (r *Room) dump(err error) RoomDump {
+	d := RoomDump{
+		Time:       time.Now().UTC(),
+		Code:       r.code,
+		State:      stateName(r.state),
+		Map:        r.gameConfig.name,
+		Options:    r.options,
+		Series:     r.series.status(true),
+		Spectators: len(r.spectators),
+	}
+	if err != nil {
+		d.Error = err.Error()
+		if pe, ok := err.(PanicError); ok {
+			d.Stack = pe.Stack
+		}
+	}
+	for _, isP1 := range []bool{true, false} {
+		chans, seat := r.playerChans(isP1)
+		queued := r.queuedP2
+		if isP1 {
+			queued = r.queuedP1
+		}
+		d.Seats = append(d.Seats, SeatDump{
+			Connected: chans.read != nil,
+			Holding:   seat.reconnect != nil,
+			Turns:     len(seat.results),
+			Timeouts:  seat.timeouts,
+			Rematch:   seat.rematch,
+			Queued:    queued.queued,
+			Actions:   queued.actions,
+		})
+	}
+	if r.gamestate != nil {
+		snapshot := r.gamestate.Snapshot()
+		d.Game = &snapshot
+	}
+	return d
+}
+
+// saveDump records the room state for a post mortem, to a file when a dump
+// directory is set and to stdout otherwise.
+func (r *Room) saveDump(err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			fmt.Println("room: dump failed:", v)
+		}
+	}()
+
+	data, jsonErr := json.MarshalIndent(r.dump(err), "", "  ")
+	if jsonErr != nil {
+		fmt.Println("room: dump failed:", jsonErr)
+		return
+	}
+	if r.settings.dumpDir == "" {
+		fmt.Println(string(data))
+		return
+	}
+	name := fmt.Sprintf("room-%d.json", time.Now().UnixNano())
+	path := filepath.Join(r.settings.dumpDir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		fmt.Println("room: dump failed:", err)
+		return
+	}
+	fmt.Println("room: dump saved:", path)
+}
+
+// fail closes a room after a fault, other rooms keep running.
+func (r *Room) fail(err error) {
+	fmt.Printf("room %s: %v\n", r.code, err)
+	r.saveDump(err)
+	if r.state == r.closing {
+		return
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			fmt.Printf("room %s: teardown: %v\n", r.code, v)
+			r.setState(r.closing)
+			r.requestClose()
+		}
+	}()
+	detail := "room closed after an internal error"
+	r.rejectPlayer(true, ErrInternal, detail)
+	r.rejectPlayer(false, ErrInternal, detail)
+	r.closeRoom()
+}
+
+// fail hangs up a connection after a fault, its room sees a player quitting.
+func (p *Player) fail(err error) {
+	fmt.Println("player:", err)
+	if p.state == p.waitForClose {
+		return
+	}
+	p.reject(ErrInternal, "connection closed after an internal error")
+	p.hangUp(websocket.CloseInternalServerErr, "internal error")
+	if p.done != nil {
+		p.quitRoom()
+	}
+	p.setState(p.waitForClose)
+}
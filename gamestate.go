@@ -1,17 +1,22 @@
 package main
 
+import "sort"
+
 type TankActionType int
 
 const (
 	TankMove TankActionType = 1
 	TankFire TankActionType = 2
+	// fires at Target over whatever is in between
+	TankIndirectFire TankActionType = 3
 )
 
 type TankAction struct {
-	Type TankActionType `json:"type"`
-	Id   int            `json:"id"`
-	Dir  Vector         `json:"dir"`
-	Path []Vector       `json:"path"`
+	Type   TankActionType `json:"type"`
+	Id     int            `json:"id"`
+	Dir    Vector         `json:"dir"`
+	Path   []Vector       `json:"path"`
+	Target Vector         `json:"target"`
 }
 
 type Tank struct {
@@ -21,6 +26,15 @@ type Tank struct {
 	visible   bool
 	destroyed bool
 	seen      bool
+	hp        int
+	class     TankClass
+}
+
+// Shell is delayed indirect fire, it lands at the start of the next turn.
+type Shell struct {
+	id     int
+	target Vector
+	splash int
 }
 
 type Hex struct {
@@ -50,6 +64,10 @@ const (
 	Destroyed TurnResultType = 5
 	Visible   TurnResultType = 6
 	Shrink    TurnResultType = 7
+	Action    TurnResultType = 8
+	Damage    TurnResultType = 9
+	// the explosion follows right away unless the shell is delayed
+	IndirectFire TurnResultType = 10
 )
 
 type TurnResultMove2 struct {
@@ -89,6 +107,18 @@ func newTurnResultFire(id int, dir Vector) TurnResultFire {
 	return TurnResultFire{Type: Fire, Id: id, Dir: dir}
 }
 
+type TurnResultIndirectFire struct {
+	Type    TurnResultType `json:"type"`
+	Id      int            `json:"id"`
+	Target  Vector         `json:"target"`
+	Delayed bool           `json:"delayed"`
+}
+
+func (tr TurnResultIndirectFire) isTurnResult() {}
+func newTurnResultIndirectFire(id int, target Vector, delayed bool) TurnResultIndirectFire {
+	return TurnResultIndirectFire{Type: IndirectFire, Id: id, Target: target, Delayed: delayed}
+}
+
 type TurnResultExplosion struct {
 	Type      TurnResultType `json:"type"`
 	P         Vector         `json:"p"`
@@ -115,6 +145,21 @@ func newTurnResultDestroyed(p Vector, id int) TurnResultDestroyed {
 	return TurnResultDestroyed{Type: Destroyed, P: p, Id: id}
 }
 
+// TurnResultDamage follows the explosion of a shell that hit a tank.
+type TurnResultDamage struct {
+	Type   TurnResultType `json:"type"`
+	Id     int            `json:"id"`
+	P      Vector         `json:"p"`
+	Damage int            `json:"damage"`
+	// hit points left, zero when the tank was destroyed
+	HP int `json:"hp"`
+}
+
+func (tr TurnResultDamage) isTurnResult() {}
+func newTurnResultDamage(id int, p Vector, damage, hp int) TurnResultDamage {
+	return TurnResultDamage{Type: Damage, Id: id, P: p, Damage: damage, HP: hp}
+}
+
 type TurnResultVisible struct {
 	Type    TurnResultType `json:"type"`
 	Id      int            `json:"id"`
@@ -138,12 +183,70 @@ func newTurnResultShrink(r int, started bool) TurnResultShrink {
 	return TurnResultShrink{Type: Shrink, R: r, Started: started}
 }
 
+type ActionStatus int
+
+const (
+	ActionAccepted  ActionStatus = 1
+	ActionTruncated ActionStatus = 2
+	ActionRejected  ActionStatus = 3
+)
+
+// ActionReason values are part of the protocol like ErrorCode.
+type ActionReason string
+
+const (
+	ReasonUnknownTank      ActionReason = "unknown_tank"
+	ReasonDestroyedTank    ActionReason = "destroyed_tank"
+	ReasonDuplicateTank    ActionReason = "duplicate_tank"
+	ReasonUnknownAction    ActionReason = "unknown_action"
+	ReasonInvalidDirection ActionReason = "invalid_direction"
+	ReasonTooShort         ActionReason = "too_short"
+	ReasonTooLong          ActionReason = "too_long"
+	ReasonWrongStart       ActionReason = "wrong_start"
+	ReasonNotAdjacent      ActionReason = "not_adjacent"
+	ReasonRevisit          ActionReason = "revisit"
+	ReasonOffMap           ActionReason = "off_map"
+	ReasonSite             ActionReason = "site"
+	ReasonOccupied         ActionReason = "occupied"
+	ReasonImpassable       ActionReason = "impassable"
+	ReasonTooCostly        ActionReason = "too_costly"
+	ReasonNoIndirectFire   ActionReason = "no_indirect_fire"
+	ReasonOutOfRange       ActionReason = "out_of_range"
+)
+
+// TurnResultAction tells the submitting player what became of one of its
+// actions, it is never sent to the enemy.
+type TurnResultAction struct {
+	Type TurnResultType `json:"type"`
+	// position of the action in the submitted turn
+	Index  int          `json:"index"`
+	Id     int          `json:"id"`
+	Status ActionStatus `json:"status"`
+	// index of the first path step that wasnt taken, truncated moves only
+	At     int          `json:"at"`
+	Reason ActionReason `json:"reason"`
+}
+
+func (tr TurnResultAction) isTurnResult() {}
+func newTurnResultAction(index, id int, status ActionStatus, at int, reason ActionReason) TurnResultAction {
+	return TurnResultAction{
+		Type:   Action,
+		Index:  index,
+		Id:     id,
+		Status: status,
+		At:     at,
+		Reason: reason,
+	}
+}
+
 type GameState struct {
 	cfg GameConfig
 
 	tanksP1 map[int]*Tank
 	tanksP2 map[int]*Tank
 	hexes   map[Vector]*Hex
+	terrain map[Vector]TerrainType
+	shells  []Shell
 
 	turnP1 bool
 	turn   int
@@ -153,6 +256,9 @@ type GameState struct {
 	curEnemy         map[int]*Tank
 	curResultsPlayer []TurnResult
 	curResultsEnemy  []TurnResult
+	// every event of the turn regardless of fog of war, visibility changes
+	// excluded
+	curResultsAll []TurnResult
 }
 
 func NewGameState(cfg GameConfig) *GameState {
@@ -172,30 +278,42 @@ func NewGameState(cfg GameConfig) *GameState {
 	}
 
 	for _, pt := range cfg.tanksP1 {
-		tanksP1[pt.Id] = &Tank{id: pt.Id, p: pt.P}
+		class := cfg.tankClass(pt)
+		tanksP1[pt.Id] = &Tank{id: pt.Id, p: pt.P, hp: class.HP, class: class}
 	}
 
 	for _, et := range cfg.tanksP2 {
-		tanksP2[et.Id] = &Tank{id: et.Id, p: et.P}
-	}
-
-	for _, t1 := range tanksP1 {
-		for _, t2 := range tanksP2 {
-			if t1.p.distance(t2.p) <= cfg.visibilityRange {
-				t1.visible = true
-				t2.visible = true
-			}
-		}
+		class := cfg.tankClass(et)
+		tanksP2[et.Id] = &Tank{id: et.Id, p: et.P, hp: class.HP, class: class}
 	}
 
-	return &GameState{
+	gs := &GameState{
 		cfg:     cfg,
 		tanksP1: tanksP1,
 		tanksP2: tanksP2,
 		hexes:   hexes,
+		terrain: cfg.terrainMap(),
+		turnP1:  cfg.p1First,
 		turn:    1,
 		radius:  cfg.radius,
 	}
+	for _, t1 := range tanksP1 {
+		for _, t2 := range tanksP2 {
+			// sight differs between classes, so one side may see the other
+			// without being seen
+			if gs.canSee(t1, t2.p) {
+				t2.visible = true
+			}
+			if gs.canSee(t2, t1.p) {
+				t1.visible = true
+			}
+		}
+	}
+	return gs
+}
+
+func (gs *GameState) Turn() int {
+	return gs.turn
 }
 
 func (gs *GameState) ClientConfigs() (ClientConfig, ClientConfig) {
@@ -232,9 +350,12 @@ func (gs *GameState) Result() (GameResult, GameResult, bool) {
 func (gs *GameState) ResolveActions(p1, p2 []TankAction) ([]TurnResult, []TurnResult) {
 	gs.curResultsPlayer = []TurnResult{}
 	gs.curResultsEnemy = []TurnResult{}
+	gs.curResultsAll = []TurnResult{}
 	gs.curPlayer = gs.tanksP1
 	gs.curEnemy = gs.tanksP2
 
+	gs.landShells()
+
 	if gs.turnP1 {
 		gs.resolveSinglePlayer(p1)
 	}
@@ -260,6 +381,22 @@ func (gs *GameState) ResolveActions(p1, p2 []TankAction) ([]TurnResult, []TurnRe
 
 }
 
+// OmniscientResults returns every event of the last resolved turn, as seen
+// without fog of war.
+func (gs *GameState) OmniscientResults() []TurnResult {
+	return gs.curResultsAll
+}
+
+func (gs *GameState) emit(res TurnResult, toPlayer, toEnemy bool) {
+	if toPlayer {
+		gs.curResultsPlayer = append(gs.curResultsPlayer, res)
+	}
+	if toEnemy {
+		gs.curResultsEnemy = append(gs.curResultsEnemy, res)
+	}
+	gs.curResultsAll = append(gs.curResultsAll, res)
+}
+
 func (gs *GameState) resolveShrinking() {
 	after := gs.cfg.shrinkAfter
 	interval := gs.cfg.shrinkInterval
@@ -268,31 +405,26 @@ func (gs *GameState) resolveShrinking() {
 	if !shrinksNow {
 		if shrinksNext {
 			shrinkResult := newTurnResultShrink(gs.radius, false)
-			gs.curResultsPlayer = append(gs.curResultsPlayer, shrinkResult)
-			gs.curResultsEnemy = append(gs.curResultsEnemy, shrinkResult)
+			gs.emit(shrinkResult, true, true)
 		}
 		return
 	}
 
-	for _, t := range gs.curEnemy {
+	for _, t := range sortedTanks(gs.curEnemy) {
 		if !t.destroyed && t.p.distance(gs.cfg.center) >= gs.radius {
 			t.destroyed = true
+			t.hp = 0
 			res := newTurnResultDestroyingExplosion(t.p, t.id)
-			gs.curResultsEnemy = append(gs.curResultsEnemy, res)
-			if t.visible {
-				gs.curResultsPlayer = append(gs.curResultsPlayer, res)
-			}
+			gs.emit(res, t.visible, true)
 		}
 	}
 
-	for _, t := range gs.curPlayer {
+	for _, t := range sortedTanks(gs.curPlayer) {
 		if !t.destroyed && t.p.distance(gs.cfg.center) >= gs.radius {
 			t.destroyed = true
+			t.hp = 0
 			res := newTurnResultDestroyingExplosion(t.p, t.id)
-			gs.curResultsPlayer = append(gs.curResultsPlayer, res)
-			if t.visible {
-				gs.curResultsEnemy = append(gs.curResultsEnemy, res)
-			}
+			gs.emit(res, true, t.visible)
 		}
 	}
 
@@ -303,8 +435,7 @@ func (gs *GameState) resolveShrinking() {
 	}
 
 	shrinkResult := newTurnResultShrink(gs.radius, true)
-	gs.curResultsPlayer = append(gs.curResultsPlayer, shrinkResult)
-	gs.curResultsEnemy = append(gs.curResultsEnemy, shrinkResult)
+	gs.emit(shrinkResult, true, true)
 
 	gs.updateVisibilities()
 
@@ -312,25 +443,26 @@ func (gs *GameState) resolveShrinking() {
 
 	if shrinksNext {
 		shrinkResult := newTurnResultShrink(gs.radius, false)
-		gs.curResultsPlayer = append(gs.curResultsPlayer, shrinkResult)
-		gs.curResultsEnemy = append(gs.curResultsEnemy, shrinkResult)
+		gs.emit(shrinkResult, true, true)
 	}
 }
 
-func (gs *GameState) resolveTankMove(path []Vector, tank *Tank) {
-	validPath := gs.validPath(path, tank)
-	if len(validPath) < 2 {
+func (gs *GameState) resolveTankMove(index int, path []Vector, tank *Tank) {
+	validPath, reason := gs.validPath(path, tank)
+	switch {
+	case len(validPath) < 2:
+		gs.actionOutcome(index, tank.id, ActionRejected, 0, reason)
 		return
+	case reason != "":
+		gs.actionOutcome(index, tank.id, ActionTruncated, len(validPath), reason)
+	default:
+		gs.actionOutcome(index, tank.id, ActionAccepted, 0, "")
 	}
 
 	startResult := newTurnResultMove2(
 		tank.id, validPath[0], validPath[1], true,
 	)
-	gs.curResultsPlayer = append(gs.curResultsPlayer, startResult)
-
-	if tank.visible {
-		gs.curResultsEnemy = append(gs.curResultsEnemy, startResult)
-	}
+	gs.emit(startResult, true, tank.visible)
 
 	for i := 0; i < len(validPath)-2; i++ {
 		p1, p2, p3 := validPath[i], validPath[i+1], validPath[i+2]
@@ -343,10 +475,7 @@ func (gs *GameState) resolveTankMove(path []Vector, tank *Tank) {
 			p2,
 			p3,
 		)
-		gs.curResultsPlayer = append(gs.curResultsPlayer, midResult)
-		if tank.visible {
-			gs.curResultsEnemy = append(gs.curResultsEnemy, midResult)
-		}
+		gs.emit(midResult, true, tank.visible)
 	}
 
 	iLast := len(validPath) - 1
@@ -356,71 +485,143 @@ func (gs *GameState) resolveTankMove(path []Vector, tank *Tank) {
 	endResult := newTurnResultMove2(
 		tank.id, validPath[iLast-1], validPath[iLast], false,
 	)
-	gs.curResultsPlayer = append(gs.curResultsPlayer, endResult)
-
-	if tank.visible {
-		gs.curResultsEnemy = append(gs.curResultsEnemy, endResult)
-	}
+	gs.emit(endResult, true, tank.visible)
 }
 
-func (gs *GameState) resolveTankFire(dir Vector, tank *Tank) {
+func (gs *GameState) resolveTankFire(index int, dir Vector, tank *Tank) {
 	if !dir.isUnit() {
+		gs.actionOutcome(index, tank.id, ActionRejected, 0, ReasonInvalidDirection)
 		return
 	}
+	gs.actionOutcome(index, tank.id, ActionAccepted, 0, "")
 	res := newTurnResultFire(tank.id, dir)
-	gs.curResultsPlayer = append(gs.curResultsPlayer, res)
-	if tank.visible {
-		gs.curResultsEnemy = append(gs.curResultsEnemy, res)
-	}
+	gs.emit(res, true, tank.visible)
 
 	cur := tank.p
-	for range gs.cfg.fireRange {
+	for range tank.class.FireRange {
 		cur = cur.add(dir)
 		if gs.collides(cur) {
 			break
 		}
 	}
 
-	visPlayer, visEnemy := gs.visible(cur)
-
 	if colTank := gs.getCollidingTank(cur); colTank != nil {
-		colTank.destroyed = true
-		explosion := newTurnResultDestroyingExplosion(cur, colTank.id)
-		if visPlayer {
-			gs.curResultsPlayer = append(gs.curResultsPlayer, explosion)
-		}
-		if visEnemy {
-			gs.curResultsEnemy = append(gs.curResultsEnemy, explosion)
-		}
-		gs.updateVisibilities()
+		gs.hit(colTank, gs.cfg.damageAt(tank.p.distance(cur), colTank.class.Armor))
 		return
 	}
+	visPlayer, visEnemy := gs.visible(cur)
 	explosion := newTurnResultExplosion(cur)
-	if visPlayer {
-		gs.curResultsPlayer = append(gs.curResultsPlayer, explosion)
+	gs.emit(explosion, visPlayer, visEnemy)
+}
+
+func (gs *GameState) resolveTankIndirectFire(index int, target Vector, tank *Tank) {
+	class := tank.class
+	distance := tank.p.distance(target)
+	_, onMap := gs.hexes[target]
+	switch {
+	case class.IndirectMaxRange == 0:
+		gs.actionOutcome(index, tank.id, ActionRejected, 0, ReasonNoIndirectFire)
+		return
+	case distance < class.IndirectMinRange || distance > class.IndirectMaxRange:
+		gs.actionOutcome(index, tank.id, ActionRejected, 0, ReasonOutOfRange)
+		return
+	case !onMap:
+		gs.actionOutcome(index, tank.id, ActionRejected, 0, ReasonOffMap)
+		return
+	}
+	gs.actionOutcome(index, tank.id, ActionAccepted, 0, "")
+	res := newTurnResultIndirectFire(tank.id, target, class.IndirectDelayed)
+	gs.emit(res, true, tank.visible)
+
+	shell := Shell{id: tank.id, target: target, splash: class.SplashDamage}
+	if class.IndirectDelayed {
+		gs.shells = append(gs.shells, shell)
+		return
 	}
-	if visEnemy {
-		gs.curResultsEnemy = append(gs.curResultsEnemy, explosion)
+	gs.landShell(shell)
+}
+
+// landShells lands the shells fired last turn in the order they were fired.
+func (gs *GameState) landShells() {
+	shells := gs.shells
+	gs.shells = nil
+	for _, s := range shells {
+		gs.landShell(s)
 	}
 }
 
+// landShell hits a tank on the target as if from the next hex, tanks around
+// it take the splash damage less their armor.
+func (gs *GameState) landShell(s Shell) {
+	if t := gs.getCollidingTank(s.target); t != nil {
+		gs.hit(t, gs.cfg.damageAt(1, t.class.Armor))
+	} else {
+		visPlayer, visEnemy := gs.visible(s.target)
+		gs.emit(newTurnResultExplosion(s.target), visPlayer, visEnemy)
+	}
+	for _, dir := range unitVectors {
+		t := gs.getCollidingTank(s.target.add(dir))
+		if t == nil || s.splash <= t.class.Armor {
+			continue
+		}
+		gs.hit(t, s.splash-t.class.Armor)
+	}
+}
+
+// hit deals damage to t, the explosion and the damage are reported to the
+// players that see the tank.
+func (gs *GameState) hit(t *Tank, damage int) {
+	visPlayer, visEnemy := gs.visible(t.p)
+	t.hp = max(t.hp-damage, 0)
+	damaged := newTurnResultDamage(t.id, t.p, damage, t.hp)
+	if t.hp > 0 {
+		gs.emit(newTurnResultExplosion(t.p), visPlayer, visEnemy)
+		gs.emit(damaged, visPlayer, visEnemy)
+		return
+	}
+	t.destroyed = true
+	explosion := newTurnResultDestroyingExplosion(t.p, t.id)
+	gs.emit(explosion, visPlayer, visEnemy)
+	gs.emit(damaged, visPlayer, visEnemy)
+	gs.updateVisibilities()
+}
+
 func (gs *GameState) resolveSinglePlayer(actions []TankAction) {
-	for _, action := range actions {
+	for i, action := range actions {
 		tank, ok := gs.curPlayer[action.Id]
-		if !ok || tank.exercised || tank.destroyed {
+		switch {
+		case !ok:
+			gs.actionOutcome(i, action.Id, ActionRejected, 0, ReasonUnknownTank)
+			continue
+		case tank.destroyed:
+			gs.actionOutcome(i, action.Id, ActionRejected, 0, ReasonDestroyedTank)
+			continue
+		case tank.exercised:
+			gs.actionOutcome(i, action.Id, ActionRejected, 0, ReasonDuplicateTank)
 			continue
 		}
 		tank.exercised = true
 
 		switch action.Type {
 		case TankMove:
-			gs.resolveTankMove(action.Path, tank)
+			gs.resolveTankMove(i, action.Path, tank)
 		case TankFire:
-			gs.resolveTankFire(action.Dir, tank)
+			gs.resolveTankFire(i, action.Dir, tank)
+		case TankIndirectFire:
+			gs.resolveTankIndirectFire(i, action.Target, tank)
+		default:
+			gs.actionOutcome(i, action.Id, ActionRejected, 0, ReasonUnknownAction)
 		}
 	}
 }
 
+// actionOutcome is reported to the submitting player only, spectators and the
+// omniscient stream dont get it either.
+func (gs *GameState) actionOutcome(index, id int, status ActionStatus, at int, reason ActionReason) {
+	res := newTurnResultAction(index, id, status, at, reason)
+	gs.curResultsPlayer = append(gs.curResultsPlayer, res)
+}
+
 func (gs *GameState) resetExercised() {
 	for _, t := range gs.tanksP1 {
 		t.exercised = false
@@ -433,12 +634,12 @@ func (gs *GameState) resetExercised() {
 func (gs *GameState) visible(p Vector) (bool, bool) {
 	visPlayer, visEnemy := false, false
 	for _, t := range gs.curPlayer {
-		if !t.destroyed && t.p.distance(p) <= gs.cfg.visibilityRange {
+		if !t.destroyed && gs.canSee(t, p) {
 			visPlayer = true
 		}
 	}
 	for _, t := range gs.curEnemy {
-		if !t.destroyed && t.p.distance(p) <= gs.cfg.visibilityRange {
+		if !t.destroyed && gs.canSee(t, p) {
 			visEnemy = true
 		}
 	}
@@ -481,7 +682,7 @@ func (gs *GameState) collidesWithSite(p Vector) bool {
 func (gs *GameState) playerVisibilities(tanks1, tanks2 map[int]*Tank) []TurnResult {
 	visibilities := []TurnResult{}
 
-	for _, et := range tanks2 {
+	for _, et := range sortedTanks(tanks2) {
 		if et.seen {
 			continue
 		}
@@ -490,7 +691,7 @@ func (gs *GameState) playerVisibilities(tanks1, tanks2 map[int]*Tank) []TurnResu
 			if pt.destroyed {
 				continue
 			}
-			if et.p.distance(pt.p) <= gs.cfg.visibilityRange {
+			if gs.canSee(pt, et.p) {
 				isVisible = true
 				break
 			}
@@ -528,6 +729,16 @@ func (gs *GameState) updateVisibilities() {
 	gs.curResultsEnemy = append(gs.curResultsEnemy, visibilitiesEnemy...)
 }
 
+// sortedTanks orders tanks by id so events come out the same on every run.
+func sortedTanks(tanks map[int]*Tank) []*Tank {
+	sorted := make([]*Tank, 0, len(tanks))
+	for _, t := range tanks {
+		sorted = append(sorted, t)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].id < sorted[j].id })
+	return sorted
+}
+
 func containsVector(vecs []Vector, v Vector) bool {
 	for _, vv := range vecs {
 		if v == vv {
@@ -537,24 +748,33 @@ func containsVector(vecs []Vector, v Vector) bool {
 	return false
 }
 
-func (gs *GameState) validPath(path []Vector, tank *Tank) []Vector {
+// validPath returns the part of path the tank can drive and why it stops
+// short, the reason is empty when the whole path is valid.
+func (gs *GameState) validPath(path []Vector, tank *Tank) ([]Vector, ActionReason) {
 	validPath := make([]Vector, 0)
-	if len(path) < 2 || len(path) > gs.cfg.driveRange+1 || tank.p != path[0] {
-		return validPath
+	switch {
+	case len(path) < 2:
+		return validPath, ReasonTooShort
+	case len(path) > tank.class.DriveRange+1:
+		return validPath, ReasonTooLong
+	case tank.p != path[0]:
+		return validPath, ReasonWrongStart
 	}
 
+	spent := 0
 	for i := 1; i < len(path); i++ {
-		if !gs.isTraversable(path[i]) {
-			break
+		if !path[i].sub(path[i-1]).isUnit() {
+			return validPath, ReasonNotAdjacent
 		}
-		if path[i] == tank.p {
-			break
+		if path[i] == tank.p || containsVector(validPath, path[i]) {
+			return validPath, ReasonRevisit
 		}
-		if containsVector(validPath, path[i]) {
-			break
+		if reason := gs.stepProblem(path[i]); reason != "" {
+			return validPath, reason
 		}
-		if !path[i].sub(path[i-1]).isUnit() {
-			break
+		spent += gs.terrainAt(path[i]).Cost
+		if spent > tank.class.DriveRange {
+			return validPath, ReasonTooCostly
 		}
 
 		if i == 1 {
@@ -562,12 +782,56 @@ func (gs *GameState) validPath(path []Vector, tank *Tank) []Vector {
 		}
 		validPath = append(validPath, path[i])
 	}
-	return validPath
+	return validPath, ""
+}
+
+// stepProblem tells why p isnt traversable, empty when it is.
+func (gs *GameState) stepProblem(p Vector) ActionReason {
+	hex, ok := gs.hexes[p]
+	switch {
+	case !ok:
+		return ReasonOffMap
+	case !hex.traversable:
+		return ReasonSite
+	case gs.terrainAt(p).Impassable:
+		return ReasonImpassable
+	case !gs.isTraversable(p):
+		return ReasonOccupied
+	}
+	return ""
+}
+
+// reachable returns the cheapest cost of reaching every hex within maxCost of
+// from, a negative maxCost doesnt limit the search.
+func (gs *GameState) reachable(from Vector, maxCost int) map[Vector]int {
+	costs := map[Vector]int{from: 0}
+	frontier := []Vector{from}
+	for len(frontier) > 0 {
+		cur := frontier[0]
+		frontier = frontier[1:]
+		for _, dir := range unitVectors {
+			next := cur.add(dir)
+			if !gs.isTraversable(next) {
+				continue
+			}
+			cost := costs[cur] + gs.terrainAt(next).Cost
+			if maxCost >= 0 && cost > maxCost {
+				continue
+			}
+			// a hex is queued again whenever a cheaper way to it turns up
+			if known, ok := costs[next]; ok && known <= cost {
+				continue
+			}
+			costs[next] = cost
+			frontier = append(frontier, next)
+		}
+	}
+	return costs
 }
 
 func (gs *GameState) isTraversable(p Vector) bool {
 	hex, ok := gs.hexes[p]
-	if !ok || !hex.traversable {
+	if !ok || !hex.traversable || gs.terrainAt(p).Impassable {
 		return false
 	}
 	for _, tank := range gs.curPlayer {
@@ -1,64 +1,415 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
+const (
+	roomCodeChars  = "abcdefghijklmnopqrstuvwxyz0123456789"
+	roomCodeLength = 8
+)
+
+type HubSettings struct {
+	defaultMap string
+	// zero is unlimited
+	maxRooms        int
+	readBufferSize  int
+	writeBufferSize int
+	// origins besides the server's own allowed to connect, "*" allows any
+	allowedOrigins []string
+}
+
+func NewDefaultHubSettings() HubSettings {
+	return HubSettings{
+		defaultMap:      DefaultMapName,
+		readBufferSize:  1024,
+		writeBufferSize: 1024,
+	}
 }
 
 type RoomRequest struct {
-	code  string
-	chans RoomChans
+	code     string
+	token    string
+	spectate bool
+	options  RoomOptions
+	chans    RoomChans
 }
 
 type Hub struct {
-	roomRequests chan RoomRequest
+	settings       HubSettings
+	roomSettings   RoomSettings
+	playerSettings PlayerSettings
+	maps           map[string]GameConfig
+	upgrader       websocket.Upgrader
+	// games saved by the last shutdown, opened again once Run starts
+	checkpoints []RoomCheckpoint
+
+	roomRequests  chan RoomRequest
+	matchRequests chan RoomChans
+	matchCancels  chan RoomChans
+	botRequests   chan RoomRequest
+
+	register    chan *Player
+	unregister  chan *Player
+	shutdowns   chan shutdownRequest
+	disconnects chan chan struct{}
+	roomQueries chan roomQuery
+	broadcasts  chan string
+}
+
+// roomQuery asks for the room with code, or every room when code is empty.
+type roomQuery struct {
+	code  string
+	reply chan []*Room
+}
+
+type shutdownRequest struct {
+	deadline time.Time
+	done     chan struct{}
+}
+
+func NewHub(
+	settings HubSettings,
+	roomSettings RoomSettings,
+	playerSettings PlayerSettings,
+	maps map[string]GameConfig,
+) *Hub {
+	h := &Hub{
+		settings:       settings,
+		roomSettings:   roomSettings,
+		playerSettings: playerSettings,
+		maps:           maps,
+		roomRequests:   make(chan RoomRequest),
+		matchRequests:  make(chan RoomChans),
+		matchCancels:   make(chan RoomChans),
+		botRequests:    make(chan RoomRequest),
+		register:       make(chan *Player),
+		unregister:     make(chan *Player),
+		shutdowns:      make(chan shutdownRequest),
+		disconnects:    make(chan chan struct{}),
+		roomQueries:    make(chan roomQuery),
+		broadcasts:     make(chan string),
+	}
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:  settings.readBufferSize,
+		WriteBufferSize: settings.writeBufferSize,
+		CheckOrigin:     h.checkOrigin,
+	}
+	return h
+}
+
+// Resume has Run reopen the rooms of checkpoints, it must be called before
+// Run.
+func (h *Hub) Resume(checkpoints []RoomCheckpoint) {
+	h.checkpoints = checkpoints
+}
+
+// Shutdown stops new rooms from being created and tells every player. Running
+// games may finish until deadline, then they are checkpointed and closed.
+// It returns once every room is closed.
+func (h *Hub) Shutdown(deadline time.Time) {
+	done := make(chan struct{})
+	h.shutdowns <- shutdownRequest{deadline, done}
+	<-done
+}
+
+// Disconnect sends every connection a close frame, it returns once they are
+// all gone or ctx is done.
+func (h *Hub) Disconnect(ctx context.Context) {
+	done := make(chan struct{})
+	h.disconnects <- done
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// Rooms returns the room with code, or every room when code is empty. The
+// rooms must only be talked to through their channels.
+func (h *Hub) Rooms(ctx context.Context, code string) ([]*Room, error) {
+	reply := make(chan []*Room, 1)
+	select {
+	case h.roomQueries <- roomQuery{code, reply}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return <-reply, nil
 }
 
-func NewHub() *Hub {
-	return &Hub{make(chan RoomRequest)}
+// Broadcast sends a notice to every connected player.
+func (h *Hub) Broadcast(ctx context.Context, text string) error {
+	select {
+	case h.broadcasts <- text:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (h *Hub) Run() {
 	rooms := make(map[string]*Room)
-	closeReq := make(chan string)
+	closeReq := make(chan *Room)
+	matchQueue := []RoomChans{}
+	players := make(map[*Player]bool)
+
+	draining := false
+	var drainDeadline <-chan time.Time
+	var drained chan struct{}
+	var disconnected chan struct{}
+	var shutdownNotice ServerMessage
+
+	for _, cp := range h.checkpoints {
+		if _, ok := rooms[cp.Code]; ok {
+			fmt.Printf("hub: room %s resumed twice\n", cp.Code)
+			retireCheckpoint(cp.path, false)
+			continue
+		}
+		room, err := ResumeRoom(cp, h.roomSettings, closeReq)
+		if err != nil {
+			fmt.Printf("hub: room %s not resumed: %v\n", cp.Code, err)
+			retireCheckpoint(cp.path, false)
+			continue
+		}
+		retireCheckpoint(cp.path, true)
+		go room.Run()
+		rooms[cp.Code] = room
+		fmt.Printf("hub: room %s resumed at turn %d\n", cp.Code, cp.Game.Turn)
+	}
+	h.checkpoints = nil
 
 	for {
 		select {
 		case msg := <-h.roomRequests:
 			room, ok := rooms[msg.code]
+			if !ok && (msg.token != "" || msg.spectate) {
+				go rejectRequest(msg.chans, ErrRoomNotFound, "room doesnt exist")
+				break
+			}
+			if !ok && draining {
+				go rejectRequest(msg.chans, ErrShuttingDown, "server is shutting down")
+				break
+			}
+			if !ok && h.full(rooms) {
+				go rejectRequest(msg.chans, ErrServerFull, "too many rooms open")
+				break
+			}
 			if !ok {
-				room = NewRoom(msg.code, closeReq)
+				gameConfig, found := h.gameConfig(msg.options)
+				if !found {
+					go rejectRequest(msg.chans, ErrUnknownMap, "map doesnt exist")
+					break
+				}
+				room = NewRoom(msg.code, h.roomSettings, gameConfig, closeReq)
 				go room.Run()
 				rooms[msg.code] = room
 			}
 			room.requests <- msg
-		case code := <-closeReq:
-			room, ok := rooms[code]
-			if !ok {
-				fmt.Println("illegal")
+		case chans := <-h.matchRequests:
+			if draining {
+				go rejectRequest(chans, ErrShuttingDown, "server is shutting down")
+				break
+			}
+			matchQueue = append(matchQueue, chans)
+			if len(matchQueue) < 2 {
+				break
+			}
+			// the hub may have filled up while the first player was queued
+			if h.full(rooms) {
+				for _, queued := range matchQueue[:2] {
+					go rejectRequest(queued, ErrServerFull, "too many rooms open")
+				}
+				matchQueue = matchQueue[2:]
+				break
+			}
+			code := newRoomCode(rooms)
+			room := NewRoom(code, h.roomSettings, h.maps[h.settings.defaultMap], closeReq)
+			go room.Run()
+			rooms[code] = room
+			room.requests <- RoomRequest{code: code, chans: matchQueue[0]}
+			room.requests <- RoomRequest{code: code, chans: matchQueue[1]}
+			matchQueue = matchQueue[2:]
+		case msg := <-h.botRequests:
+			if draining {
+				go rejectRequest(msg.chans, ErrShuttingDown, "server is shutting down")
+				break
+			}
+			if h.full(rooms) {
+				go rejectRequest(msg.chans, ErrServerFull, "too many rooms open")
+				break
+			}
+			gameConfig, found := h.gameConfig(msg.options)
+			if !found {
+				go rejectRequest(msg.chans, ErrUnknownMap, "map doesnt exist")
+				break
+			}
+			code := newRoomCode(rooms)
+			room := NewRoom(code, h.roomSettings, gameConfig, closeReq)
+			go room.Run()
+			rooms[code] = room
+			msg.code = code
+			room.requests <- msg
+
+			bot := NewBot()
+			go bot.Run()
+			room.requests <- RoomRequest{code: code, chans: bot.chans}
+		case chans := <-h.matchCancels:
+			for i, queued := range matchQueue {
+				if queued == chans {
+					matchQueue = append(matchQueue[:i], matchQueue[i+1:]...)
+					close(chans.read)
+					break
+				}
+			}
+		case room := <-closeReq:
+			// a room closing late must not take a newer room with its code along
+			if rooms[room.code] != room {
+				fmt.Printf("hub: room %s already closed\n", room.code)
 				break
 			}
 			close(room.requests)
-			delete(rooms, code)
+			delete(rooms, room.code)
+			if drained != nil && len(rooms) == 0 {
+				close(drained)
+				drained = nil
+			}
+		case p := <-h.register:
+			players[p] = true
+			if draining {
+				p.notify(shutdownNotice)
+			}
+		case p := <-h.unregister:
+			delete(players, p)
+			if disconnected != nil && len(players) == 0 {
+				close(disconnected)
+				disconnected = nil
+			}
+		case req := <-h.shutdowns:
+			draining = true
+			drained = req.done
+			drainDeadline = time.After(time.Until(req.deadline))
+			shutdownNotice = newShutdownMessage(req.deadline)
+			for _, chans := range matchQueue {
+				go rejectRequest(chans, ErrShuttingDown, "server is shutting down")
+			}
+			matchQueue = nil
+			for p := range players {
+				p.notify(shutdownNotice)
+			}
+			for _, room := range rooms {
+				close(room.drain)
+			}
+			if len(rooms) == 0 {
+				close(drained)
+				drained = nil
+			}
+		case <-drainDeadline:
+			drainDeadline = nil
+			for _, room := range rooms {
+				close(room.stop)
+			}
+		case query := <-h.roomQueries:
+			found := []*Room{}
+			if query.code != "" {
+				if room, ok := rooms[query.code]; ok {
+					found = append(found, room)
+				}
+			} else {
+				for _, room := range rooms {
+					found = append(found, room)
+				}
+			}
+			query.reply <- found
+		case text := <-h.broadcasts:
+			notice := newNoticeMessage(text)
+			for p := range players {
+				p.notify(notice)
+			}
+		case done := <-h.disconnects:
+			disconnected = done
+			for p := range players {
+				p.disconnect(websocket.CloseGoingAway, "server shutting down")
+			}
+			if len(players) == 0 {
+				close(disconnected)
+				disconnected = nil
+			}
+		}
+	}
+}
+
+func (h *Hub) gameConfig(options RoomOptions) (GameConfig, bool) {
+	name := options.Map
+	if name == "" {
+		name = h.settings.defaultMap
+	}
+	if name == GeneratedMapName {
+		seed := rand.Uint64()
+		if options.Seed != nil {
+			seed = *options.Seed
+		}
+		gameConfig, err := GenerateMap(NewDefaultMapGenParams(seed))
+		if err != nil {
+			fmt.Println("hub:", err)
+			return GameConfig{}, false
+		}
+		return gameConfig, true
+	}
+	gameConfig, ok := h.maps[name]
+	return gameConfig, ok
+}
+
+func (h *Hub) full(rooms map[string]*Room) bool {
+	return h.settings.maxRooms > 0 && len(rooms) >= h.settings.maxRooms
+}
+
+// checkOrigin lets through requests without an origin, same origin requests
+// and the configured origins.
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range h.settings.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func newRoomCode(rooms map[string]*Room) string {
+	for {
+		code := make([]byte, roomCodeLength)
+		for i := range code {
+			code[i] = roomCodeChars[rand.IntN(len(roomCodeChars))]
+		}
+		if _, ok := rooms[string(code)]; !ok {
+			return string(code)
 		}
 	}
 }
 
 func (h *Hub) ServeWs(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		fmt.Println("hub: conn error")
 		return
 	}
 
-	player := NewPlayer(conn, h.roomRequests)
+	player := NewPlayer(conn, h)
+	h.register <- player
 
 	fmt.Println("start player goroutine")
 	go player.Run()
@@ -1,20 +1,138 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
-import _ "net/http/pprof"
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "mapcheck":
+			os.Exit(runMapcheck(os.Args[2:]))
+		case "mapgen":
+			os.Exit(runMapgen(os.Args[2:]))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		}
+	}
+
+	cfg, err := LoadServerConfig(os.Args[1:])
+	if err != nil {
+		fmt.Println("config:", err)
+		os.Exit(1)
+	}
+	effective, _ := json.MarshalIndent(cfg.redacted(), "", "  ")
+	fmt.Printf("config: %s\n", effective)
+
+	maps, err := LoadMaps(cfg.MapsDir)
+	if err != nil {
+		fmt.Println("maps:", err)
+		os.Exit(1)
+	}
+	if _, ok := maps[DefaultMapName]; !ok {
+		maps[DefaultMapName] = NewBasicConfig(false, true)
+	}
+	if _, ok := maps[cfg.DefaultMap]; !ok {
+		fmt.Printf("maps: default map %q not found\n", cfg.DefaultMap)
+		os.Exit(1)
+	}
+	fmt.Println("loaded maps:", len(maps))
+
+	for _, dir := range []string{cfg.ReplayDir, cfg.DumpDir, cfg.CheckpointDir} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			fmt.Println("dirs:", err)
+			os.Exit(1)
+		}
+	}
+
+	checkpoints, err := LoadCheckpoints(cfg.CheckpointDir)
+	if err != nil {
+		fmt.Println("checkpoints:", err)
+		os.Exit(1)
+	}
+
+	var static http.Handler
+	if cfg.StaticDir != "" {
+		static = http.FileServer(http.Dir(cfg.StaticDir))
+		fmt.Println("static: serving", cfg.StaticDir)
+	} else {
+		embedded, err := NewStaticHandler(EmbeddedWebDist(), time.Duration(cfg.StaticMaxAge))
+		if err != nil {
+			fmt.Println("static:", err)
+			os.Exit(1)
+		}
+		static = embedded
+		fmt.Println("static: embedded files:", embedded.Len())
+	}
+
 	fmt.Println("hello")
-	hub := NewHub()
+	hub := NewHub(cfg.hubSettings(), cfg.roomSettings(), cfg.playerSettings(), maps)
+	hub.Resume(checkpoints)
 	go hub.Run()
 
-	static := http.Dir("web/dist")
+	mux := http.NewServeMux()
+	mux.Handle("/", static)
+	mux.HandleFunc("/ws", hub.ServeWs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout),
+	}
+	serveErr := make(chan error, 2)
+	go func() {
+		if cfg.TLSCert != "" {
+			serveErr <- server.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+			return
+		}
+		serveErr <- server.ListenAndServe()
+	}()
+
+	var admin *http.Server
+	if cfg.AdminListen != "" {
+		admin = &http.Server{
+			Addr:              cfg.AdminListen,
+			Handler:           NewAdminHandler(hub, cfg.AdminToken),
+			ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout),
+		}
+		go func() {
+			serveErr <- admin.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("http:", err)
+			os.Exit(1)
+		}
+	case <-ctx.Done():
+	}
+	stop()
 
-	http.Handle("/", http.FileServer(static))
-	http.HandleFunc("/ws", hub.ServeWs)
+	fmt.Println("shutting down, draining rooms for", time.Duration(cfg.DrainTimeout))
+	hub.Shutdown(time.Now().Add(time.Duration(cfg.DrainTimeout)))
 
-	http.ListenAndServe("localhost:8000", nil)
+	closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(closeCtx)
+	if admin != nil {
+		admin.Shutdown(closeCtx)
+	}
+	hub.Disconnect(closeCtx)
+	fmt.Println("bye")
 }
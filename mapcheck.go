@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type SideMetrics struct {
+	MinCenterDistance int     `json:"minCenterDistance"`
+	AvgCenterDistance float64 `json:"avgCenterDistance"`
+	// hexes any tank of the side can drive to on the first turn
+	ReachableHexes int `json:"reachableHexes"`
+	// hexes seen by the side at the start
+	VisibleHexes int `json:"visibleHexes"`
+	// enemy tanks seen by the side at the start
+	VisibleEnemies int `json:"visibleEnemies"`
+}
+
+type MapReport struct {
+	File     string       `json:"file"`
+	Name     string       `json:"name"`
+	Problems []string     `json:"problems"`
+	P1       *SideMetrics `json:"p1,omitempty"`
+	P2       *SideMetrics `json:"p2,omitempty"`
+	// p1 metrics minus p2 metrics
+	Asymmetry *SideMetrics `json:"asymmetry,omitempty"`
+}
+
+// runMapcheck implements `tank-ops mapcheck [-maps dir] [file...]`, it prints
+// a JSON report and exits non-zero when any map has problems.
+func runMapcheck(args []string) int {
+	fs := flag.NewFlagSet("mapcheck", flag.ExitOnError)
+	dir := fs.String("maps", "maps", "directory checked when no files are given")
+	fs.Parse(args)
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		var err error
+		paths, err = filepath.Glob(filepath.Join(*dir, "*.json"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "mapcheck:", err)
+			return 2
+		}
+		sort.Strings(paths)
+	}
+
+	reports := []MapReport{}
+	failed := false
+	for _, path := range paths {
+		report := checkMapFile(path)
+		if len(report.Problems) > 0 {
+			failed = true
+		}
+		reports = append(reports, report)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(reports)
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func checkMapFile(path string) MapReport {
+	report := MapReport{File: path, Problems: []string{}}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		report.Problems = append(report.Problems, err.Error())
+		return report
+	}
+	m, err := ParseMapConfig(data)
+	if err != nil {
+		report.Problems = append(report.Problems, err.Error())
+		return report
+	}
+	report.Name = m.Name
+	if report.Name == "" {
+		report.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+	}
+
+	gc, err := m.GameConfig()
+	if err != nil {
+		report.Problems = append(report.Problems, problemList(err)...)
+		return report
+	}
+
+	p1, p2 := gc.sideMetrics()
+	report.P1 = &p1
+	report.P2 = &p2
+	report.Asymmetry = &SideMetrics{
+		MinCenterDistance: p1.MinCenterDistance - p2.MinCenterDistance,
+		AvgCenterDistance: p1.AvgCenterDistance - p2.AvgCenterDistance,
+		ReachableHexes:    p1.ReachableHexes - p2.ReachableHexes,
+		VisibleHexes:      p1.VisibleHexes - p2.VisibleHexes,
+		VisibleEnemies:    p1.VisibleEnemies - p2.VisibleEnemies,
+	}
+	return report
+}
+
+func problemList(err error) []string {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []string{err.Error()}
+	}
+	problems := []string{}
+	for _, e := range joined.Unwrap() {
+		problems = append(problems, problemList(e)...)
+	}
+	return problems
+}
+
+func (gc GameConfig) sideMetrics() (SideMetrics, SideMetrics) {
+	gs := NewGameState(gc)
+	gs.curPlayer = gs.tanksP1
+	gs.curEnemy = gs.tanksP2
+	return gs.sideMetrics(gs.tanksP1, gs.tanksP2), gs.sideMetrics(gs.tanksP2, gs.tanksP1)
+}
+
+func (gs *GameState) sideMetrics(tanks, enemies map[int]*Tank) SideMetrics {
+	m := SideMetrics{MinCenterDistance: -1}
+	if len(tanks) == 0 {
+		return m
+	}
+
+	reachable := make(map[Vector]bool)
+	total := 0
+	for _, t := range tanks {
+		d := t.p.distance(gs.cfg.center)
+		total += d
+		if m.MinCenterDistance < 0 || d < m.MinCenterDistance {
+			m.MinCenterDistance = d
+		}
+		for p := range gs.reachable(t.p, t.class.DriveRange) {
+			if p != t.p {
+				reachable[p] = true
+			}
+		}
+	}
+	m.AvgCenterDistance = float64(total) / float64(len(tanks))
+	m.ReachableHexes = len(reachable)
+
+	for p := range gs.hexes {
+		if gs.seenBy(tanks, p) {
+			m.VisibleHexes++
+		}
+	}
+	for _, e := range enemies {
+		if gs.seenBy(tanks, e.p) {
+			m.VisibleEnemies++
+		}
+	}
+	return m
+}
+
+func (gs *GameState) seenBy(tanks map[int]*Tank, p Vector) bool {
+	for _, t := range tanks {
+		if !t.destroyed && gs.canSee(t, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestMapcheckAsymmetricMap(t *testing.T) {
+	report := checkMapFile("testdata/asymmetric.json")
+	if len(report.Problems) > 0 {
+		t.Fatalf("problems: %v", report.Problems)
+	}
+	if report.Name != "asymmetric" {
+		t.Errorf("name %q, want the file name", report.Name)
+	}
+
+	// p1 starts one hex from the center, p2 three hexes out at the end of
+	// the row
+	want := SideMetrics{
+		MinCenterDistance: -2,
+		AvgCenterDistance: -2,
+		ReachableHexes:    1,
+		VisibleHexes:      2,
+		VisibleEnemies:    0,
+	}
+	if report.Asymmetry == nil || *report.Asymmetry != want {
+		t.Errorf("asymmetry %+v, want %+v", report.Asymmetry, want)
+	}
+
+	if code := runMapcheck([]string{"testdata/asymmetric.json"}); code != 0 {
+		t.Errorf("exit status %d for a valid map", code)
+	}
+	if code := runMapcheck([]string{"testdata/asymmetric.json", "testdata/overlap.json"}); code != 1 {
+		t.Errorf("exit status %d with a broken map", code)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+)
+
+const (
+	GeneratedMapName = "generated"
+
+	hexVariants        = 3
+	siteVariants       = 9
+	mapGenMaxAttempts  = 100
+	mapGenSpawnSpacing = 2
+)
+
+type Symmetry int
+
+const (
+	SymmetryPoint  Symmetry = 1
+	SymmetryMirror Symmetry = 2
+)
+
+// mirror maps a hex of one side onto the matching hex of the other side of a
+// map centered on the origin.
+func (s Symmetry) mirror(p Vector) Vector {
+	if s == SymmetryMirror {
+		return Vector{p.Y, p.X}
+	}
+	return Vector{-p.X, -p.Y}
+}
+
+type MapGenParams struct {
+	Seed   uint64
+	Radius int
+	// fraction of hexes left out of the map
+	HoleDensity float64
+	// fraction of the remaining hexes with a site
+	SiteDensity float64
+	// tanks per side
+	Tanks      int
+	Symmetry   Symmetry
+	Visibility VisibilityModel
+	// default classes handed out to the tanks of each side in turn, empty
+	// leaves the tanks on the map ranges
+	Classes []string
+}
+
+func NewDefaultMapGenParams(seed uint64) MapGenParams {
+	return MapGenParams{
+		Seed:        seed,
+		Radius:      4,
+		HoleDensity: 0.15,
+		SiteDensity: 0.1,
+		Tanks:       2,
+		Symmetry:    SymmetryPoint,
+		Visibility:  VisibilityRange,
+	}
+}
+
+// GenerateMap builds a symmetric map from params, the same params always give
+// the same map. Layouts are retried until one passes validation.
+func GenerateMap(params MapGenParams) (GameConfig, error) {
+	if params.Radius < 2 || params.Tanks < 1 {
+		return GameConfig{}, errors.New("mapgen: radius must be at least 2 and tanks positive")
+	}
+	if params.Symmetry != SymmetryPoint && params.Symmetry != SymmetryMirror {
+		return GameConfig{}, errors.New("mapgen: unknown symmetry")
+	}
+	if err := params.Visibility.validate(); err != nil {
+		return GameConfig{}, fmt.Errorf("mapgen: %w", err)
+	}
+	for _, class := range params.Classes {
+		if findClass(DefaultTankClasses, class) == nil {
+			return GameConfig{}, fmt.Errorf("mapgen: unknown tank class %q", class)
+		}
+	}
+
+	rng := rand.New(rand.NewPCG(params.Seed, uint64(params.Radius)))
+	var err error
+	for range mapGenMaxAttempts {
+		var gc GameConfig
+		gc, err = generateLayout(params, rng)
+		if err == nil {
+			return gc, nil
+		}
+	}
+	return GameConfig{}, fmt.Errorf("mapgen: no valid layout for seed %d: %w", params.Seed, err)
+}
+
+func generateLayout(params MapGenParams, rng *rand.Rand) (GameConfig, error) {
+	center := newZeroVector()
+	sym := params.Symmetry
+
+	// walk hex pairs in a fixed order so the rng is consumed the same way for
+	// the same seed
+	pairs := [][2]Vector{}
+	for x := -params.Radius; x <= params.Radius; x++ {
+		for y := -params.Radius; y <= params.Radius; y++ {
+			p := Vector{x, y}
+			if p.distance(center) > params.Radius {
+				continue
+			}
+			m := sym.mirror(p)
+			if m.X < p.X || (m.X == p.X && m.Y < p.Y) {
+				continue
+			}
+			pairs = append(pairs, [2]Vector{p, m})
+		}
+	}
+
+	hexes := []SceneConfig{}
+	sites := []SceneConfig{}
+	candidates := []Vector{}
+	for _, pair := range pairs {
+		if pair[0] != center && rng.Float64() < params.HoleDensity {
+			continue
+		}
+		variant := rng.IntN(hexVariants)
+		isSite := rng.Float64() < params.SiteDensity
+		siteVariant := rng.IntN(siteVariants)
+
+		for i, p := range pair {
+			if i == 1 && pair[1] == pair[0] {
+				break
+			}
+			hexes = append(hexes, SceneConfig{p, variant})
+			if isSite {
+				sites = append(sites, SceneConfig{p, siteVariant})
+			}
+		}
+		if !isSite && pair[0] != pair[1] {
+			candidates = append(candidates, pair[0])
+		}
+	}
+
+	// spawn as far from the center as the first shrink allows, spread over
+	// the ring
+	rng.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	spawnsP1 := []TankConfig{}
+	spawnsP2 := []TankConfig{}
+	for dist := params.Radius - 1; dist >= 1 && len(spawnsP1) < params.Tanks; dist-- {
+		for _, p := range candidates {
+			if len(spawnsP1) == params.Tanks {
+				break
+			}
+			if p.distance(center) != dist || !spawnFits(p, sym, spawnsP1, spawnsP2) {
+				continue
+			}
+			spawnsP1 = append(spawnsP1, TankConfig{Id: len(spawnsP1) + 1, P: p})
+			spawnsP2 = append(spawnsP2, TankConfig{P: sym.mirror(p)})
+		}
+	}
+	for i := range spawnsP2 {
+		spawnsP2[i].Id = params.Tanks + i + 1
+	}
+	for i := range spawnsP1 {
+		if len(params.Classes) > 0 {
+			spawnsP1[i].Class = params.Classes[i%len(params.Classes)]
+			spawnsP2[i].Class = spawnsP1[i].Class
+		}
+	}
+
+	gc, err := MapConfig{
+		Name:            fmt.Sprintf("%s-%d", GeneratedMapName, params.Seed),
+		Hexes:           hexes,
+		Sites:           sites,
+		Spawns:          MapSpawns{spawnsP1, spawnsP2},
+		Center:          center,
+		DriveRange:      5,
+		VisibilityRange: 2,
+		FireRange:       3,
+		Visibility:      params.Visibility,
+		ShrinkAfter:     2,
+		ShrinkInterval:  3,
+	}.GameConfig()
+	if err != nil {
+		return GameConfig{}, err
+	}
+	if len(spawnsP1) < params.Tanks {
+		return GameConfig{}, errors.New("not enough room for spawns")
+	}
+	return gc, nil
+}
+
+func spawnFits(p Vector, sym Symmetry, spawnsP1, spawnsP2 []TankConfig) bool {
+	m := sym.mirror(p)
+	if p.distance(m) <= mapGenSpawnSpacing {
+		return false
+	}
+	for _, t := range append(append([]TankConfig{}, spawnsP1...), spawnsP2...) {
+		if t.P.distance(p) < mapGenSpawnSpacing || t.P.distance(m) < mapGenSpawnSpacing {
+			return false
+		}
+	}
+	return true
+}
+
+// runMapgen implements `tank-ops mapgen [flags]`, it prints the generated map
+// in the map file format.
+func runMapgen(args []string) int {
+	defaults := NewDefaultMapGenParams(0)
+	fs := flag.NewFlagSet("mapgen", flag.ExitOnError)
+	seed := fs.Uint64("seed", 0, "layout seed, the same seed gives the same map")
+	radius := fs.Int("radius", defaults.Radius, "map radius in hexes")
+	holes := fs.Float64("holes", defaults.HoleDensity, "fraction of hexes left out")
+	sites := fs.Float64("sites", defaults.SiteDensity, "fraction of hexes with a site")
+	tanks := fs.Int("tanks", defaults.Tanks, "tanks per side")
+	mirror := fs.Bool("mirror", false, "mirror the map instead of rotating it")
+	visibility := fs.String("visibility", string(defaults.Visibility), "visibility model, range or line_of_sight")
+	classes := listFlag{}
+	fs.Var(&classes, "classes", "comma separated tank classes handed out to the tanks of each side in turn")
+	fs.Parse(args)
+
+	params := MapGenParams{
+		Seed:        *seed,
+		Radius:      *radius,
+		HoleDensity: *holes,
+		SiteDensity: *sites,
+		Tanks:       *tanks,
+		Symmetry:    SymmetryPoint,
+		Visibility:  VisibilityModel(*visibility),
+		Classes:     classes,
+	}
+	if *mirror {
+		params.Symmetry = SymmetryMirror
+	}
+
+	gc, err := GenerateMap(params)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(gc.MapConfig())
+	return 0
+}
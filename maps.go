@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const DefaultMapName = "basic"
+
+type MapSpawns struct {
+	P1 []TankConfig `json:"p1"`
+	P2 []TankConfig `json:"p2"`
+}
+
+// MapConfig is the on-disk map format, see docs/maps.md.
+type MapConfig struct {
+	Name            string        `json:"name"`
+	Hexes           []SceneConfig `json:"hexes"`
+	Sites           []SceneConfig `json:"sites"`
+	Spawns          MapSpawns     `json:"spawns"`
+	Center          Vector        `json:"center"`
+	DriveRange      int           `json:"driveRange"`
+	VisibilityRange int           `json:"visibilityRange"`
+	FireRange       int           `json:"fireRange"`
+	// empty picks VisibilityRange
+	Visibility VisibilityModel `json:"visibility,omitempty"`
+	// rules for hex variants, variants without an entry are open ground
+	Terrain []TerrainType `json:"terrain,omitempty"`
+	// damage of a hit from the next hex, empty deals 1
+	Damage int `json:"damage,omitempty"`
+	// damage lost for every further hex the shell travels
+	DamageFalloff int `json:"damageFalloff,omitempty"`
+	// classes the spawns pick from besides DefaultTankClasses
+	Classes        []TankClass `json:"classes,omitempty"`
+	ShrinkAfter    int         `json:"shrinkAfter"`
+	ShrinkInterval int         `json:"shrinkInterval"`
+}
+
+func (m MapConfig) GameConfig() (GameConfig, error) {
+	visibility := m.Visibility
+	if visibility == "" {
+		visibility = VisibilityRange
+	}
+	damage := m.Damage
+	if damage == 0 {
+		damage = 1
+	}
+	radius := 0
+	for _, h := range m.Hexes {
+		radius = max(radius, h.P.distance(m.Center))
+	}
+	gc := GameConfig{
+		name:            m.Name,
+		tanksP1:         m.Spawns.P1,
+		tanksP2:         m.Spawns.P2,
+		hexes:           m.Hexes,
+		sites:           m.Sites,
+		driveRange:      m.DriveRange,
+		visibilityRange: m.VisibilityRange,
+		fireRange:       m.FireRange,
+		visibility:      visibility,
+		terrain:         m.Terrain,
+		damage:          damage,
+		damageFalloff:   m.DamageFalloff,
+		classes:         resolveClasses(m.Classes, append(append([]TankConfig{}, m.Spawns.P1...), m.Spawns.P2...)),
+		p1First:         true,
+		center:          m.Center,
+		shrinkAfter:     m.ShrinkAfter,
+		shrinkInterval:  m.ShrinkInterval,
+		radius:          radius,
+	}
+	if err := gc.validate(); err != nil {
+		return GameConfig{}, err
+	}
+	return gc, nil
+}
+
+func (gc GameConfig) MapConfig() MapConfig {
+	return MapConfig{
+		Name:            gc.name,
+		Hexes:           gc.hexes,
+		Sites:           gc.sites,
+		Spawns:          MapSpawns{gc.tanksP1, gc.tanksP2},
+		Center:          gc.center,
+		DriveRange:      gc.driveRange,
+		VisibilityRange: gc.visibilityRange,
+		FireRange:       gc.fireRange,
+		Visibility:      gc.visibility,
+		Terrain:         gc.terrain,
+		Damage:          gc.damage,
+		DamageFalloff:   gc.damageFalloff,
+		Classes:         gc.classes,
+		ShrinkAfter:     gc.shrinkAfter,
+		ShrinkInterval:  gc.shrinkInterval,
+	}
+}
+
+func ParseMapConfig(data []byte) (MapConfig, error) {
+	m := MapConfig{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return MapConfig{}, err
+	}
+	return m, nil
+}
+
+// LoadMaps reads every .json file in dir, a map without a name is named after
+// its file.
+func LoadMaps(dir string) (map[string]GameConfig, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	maps := make(map[string]GameConfig)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		m, err := ParseMapConfig(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if m.Name == "" {
+			m.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		if _, ok := maps[m.Name]; ok {
+			return nil, fmt.Errorf("%s: duplicate map name %q", path, m.Name)
+		}
+		gc, err := m.GameConfig()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		maps[m.Name] = gc
+	}
+	return maps, nil
+}
+
+// validate reports every problem found, joined into one error.
+func (gc GameConfig) validate() error {
+	errs := []error{}
+
+	if len(gc.hexes) == 0 {
+		errs = append(errs, errors.New("map has no hexes"))
+	}
+	hexes := make(map[Vector]bool)
+	for _, h := range gc.hexes {
+		if hexes[h.P] {
+			errs = append(errs, fmt.Errorf("hex %v listed twice", h.P))
+		}
+		hexes[h.P] = true
+	}
+
+	sites := make(map[Vector]bool)
+	for _, s := range gc.sites {
+		if !hexes[s.P] {
+			errs = append(errs, fmt.Errorf("site %v is off the map", s.P))
+		}
+		if sites[s.P] {
+			errs = append(errs, fmt.Errorf("site %v listed twice", s.P))
+		}
+		sites[s.P] = true
+	}
+
+	if len(gc.tanksP1) == 0 || len(gc.tanksP2) == 0 {
+		errs = append(errs, errors.New("both sides need at least one tank"))
+	}
+	ids := make(map[int]bool)
+	occupied := make(map[Vector]int)
+	for _, t := range append(append([]TankConfig{}, gc.tanksP1...), gc.tanksP2...) {
+		if ids[t.Id] {
+			errs = append(errs, fmt.Errorf("tank id %d used twice", t.Id))
+		}
+		ids[t.Id] = true
+		if !hexes[t.P] {
+			errs = append(errs, fmt.Errorf("tank %d is off the map", t.Id))
+		}
+		if sites[t.P] {
+			errs = append(errs, fmt.Errorf("tank %d starts on a site", t.Id))
+		}
+		if other, ok := occupied[t.P]; ok {
+			errs = append(errs, fmt.Errorf("tanks %d and %d share %v", other, t.Id, t.P))
+		}
+		occupied[t.P] = t.Id
+		if t.HP != nil && *t.HP < 1 || t.Armor != nil && *t.Armor < 0 {
+			errs = append(errs, fmt.Errorf("tank %d needs positive hp and no negative armor", t.Id))
+		}
+	}
+
+	if gc.driveRange < 1 || gc.visibilityRange < 1 || gc.fireRange < 1 {
+		errs = append(errs, errors.New("ranges must be positive"))
+	}
+	if gc.shrinkAfter < 1 || gc.shrinkInterval < 1 {
+		errs = append(errs, errors.New("shrink parameters must be positive"))
+	}
+	if gc.damage < 1 || gc.damageFalloff < 0 {
+		errs = append(errs, errors.New("damage must be positive and its falloff not negative"))
+	}
+	if err := gc.visibility.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, gc.validateClasses()...)
+	errs = append(errs, gc.validateTerrain()...)
+
+	if len(errs) == 0 {
+		errs = append(errs, gc.connectivityErrors()...)
+	}
+
+	return errors.Join(errs...)
+}
+
+// connectivityErrors checks every spawn can drive to every enemy spawn, tanks
+// arent treated as obstacles since they move.
+func (gc GameConfig) connectivityErrors() []error {
+	gs := NewGameState(gc)
+	gs.curPlayer = map[int]*Tank{}
+	gs.curEnemy = map[int]*Tank{}
+
+	errs := []error{}
+	for _, t1 := range gc.tanksP1 {
+		steps := gs.reachable(t1.P, -1)
+		for _, t2 := range gc.tanksP2 {
+			if _, ok := steps[t2.P]; !ok {
+				errs = append(errs, fmt.Errorf("tank %d cant reach tank %d", t1.Id, t2.Id))
+			}
+		}
+	}
+	return errs
+}
+
+// withSides sets up a map for one game, optionally handing each player the
+// other side's spawns.
+func (gc GameConfig) withSides(swapPlayers, p1First bool) GameConfig {
+	if swapPlayers {
+		gc.tanksP1, gc.tanksP2 = gc.tanksP2, gc.tanksP1
+	}
+	gc.p1First = p1First
+	return gc
+}
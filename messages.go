@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 type ServerMessageType int
 
 const (
@@ -8,6 +10,11 @@ const (
 	ServerRoomJoined       ServerMessageType = 3
 	ServerRoomDisconnected ServerMessageType = 4
 	ServerGameFinished     ServerMessageType = 5
+	ServerTurnDeadline     ServerMessageType = 6
+	ServerSeriesUpdate     ServerMessageType = 7
+	ServerError            ServerMessageType = 8
+	ServerShutdown         ServerMessageType = 9
+	ServerNotice           ServerMessageType = 10
 )
 
 type ServerMessage interface {
@@ -15,8 +22,9 @@ type ServerMessage interface {
 }
 
 type StartGameMessage struct {
-	Type   ServerMessageType `json:"type"`
-	Config ClientConfig      `json:"config"`
+	Type           ServerMessageType `json:"type"`
+	Config         ClientConfig      `json:"config"`
+	ReconnectToken string            `json:"reconnectToken"`
 }
 
 func (m StartGameMessage) isServerMessage() {}
@@ -29,7 +37,8 @@ type TurnResultsMessage struct {
 func (m TurnResultsMessage) isServerMessage() {}
 
 type RoomJoinedMessage struct {
-	Type ServerMessageType `json:"type"`
+	Type     ServerMessageType `json:"type"`
+	RoomCode string            `json:"roomCode"`
 }
 
 func (m RoomJoinedMessage) isServerMessage() {}
@@ -47,16 +56,91 @@ type GameFinishedMessage struct {
 
 func (m GameFinishedMessage) isServerMessage() {}
 
-func newStartGameMessage(config ClientConfig) StartGameMessage {
-	return StartGameMessage{ServerStartGame, config}
+type TurnDeadlineMessage struct {
+	Type ServerMessageType `json:"type"`
+	Turn int               `json:"turn"`
+	// unix time in milliseconds
+	Deadline int64 `json:"deadline"`
+}
+
+func (m TurnDeadlineMessage) isServerMessage() {}
+
+type SeriesStatus struct {
+	Game     int        `json:"game"`
+	BestOf   int        `json:"bestOf"`
+	Wins     int        `json:"wins"`
+	Losses   int        `json:"losses"`
+	Draws    int        `json:"draws"`
+	Finished bool       `json:"finished"`
+	Result   GameResult `json:"result"`
+}
+
+type SeriesUpdateMessage struct {
+	Type   ServerMessageType `json:"type"`
+	Series SeriesStatus      `json:"series"`
+}
+
+func (m SeriesUpdateMessage) isServerMessage() {}
+
+// ErrorCode values are part of the protocol, clients may rely on them so they
+// must never change meaning.
+type ErrorCode string
+
+const (
+	ErrInvalidMessage     ErrorCode = "invalid_message"
+	ErrUnknownMessage     ErrorCode = "unknown_message"
+	ErrNotInRoom          ErrorCode = "not_in_room"
+	ErrAlreadyInRoom      ErrorCode = "already_in_room"
+	ErrSpectator          ErrorCode = "spectator"
+	ErrRoomNotFound       ErrorCode = "room_not_found"
+	ErrRoomFull           ErrorCode = "room_full"
+	ErrInvalidToken       ErrorCode = "invalid_token"
+	ErrUnknownMap         ErrorCode = "unknown_map"
+	ErrInvalidMap         ErrorCode = "invalid_map"
+	ErrWaitingForOpponent ErrorCode = "waiting_for_opponent"
+	ErrGameRunning        ErrorCode = "game_running"
+	ErrGameNotRunning     ErrorCode = "game_not_running"
+	ErrInternal           ErrorCode = "internal_error"
+	ErrShuttingDown       ErrorCode = "shutting_down"
+	ErrServerFull         ErrorCode = "server_full"
+	ErrRoomClosed         ErrorCode = "room_closed"
+)
+
+type ErrorMessage struct {
+	Type   ServerMessageType `json:"type"`
+	Code   ErrorCode         `json:"code"`
+	Detail string            `json:"detail"`
+}
+
+func (m ErrorMessage) isServerMessage() {}
+
+type ShutdownMessage struct {
+	Type ServerMessageType `json:"type"`
+	// unix time in milliseconds after which running games are stopped
+	Deadline int64 `json:"deadline"`
+}
+
+func (m ShutdownMessage) isServerMessage() {}
+
+// NoticeMessage carries free text from the operators, like an upcoming
+// maintenance.
+type NoticeMessage struct {
+	Type ServerMessageType `json:"type"`
+	Text string            `json:"text"`
+}
+
+func (m NoticeMessage) isServerMessage() {}
+
+func newStartGameMessage(config ClientConfig, token string) StartGameMessage {
+	return StartGameMessage{ServerStartGame, config, token}
 }
 
 func newTurnResultsMessage(results []TurnResult) TurnResultsMessage {
 	return TurnResultsMessage{ServerTurnResults, results}
 }
 
-func newRoomJoinedMessage() RoomJoinedMessage {
-	return RoomJoinedMessage{ServerRoomJoined}
+func newRoomJoinedMessage(code string) RoomJoinedMessage {
+	return RoomJoinedMessage{ServerRoomJoined, code}
 }
 
 func newRoomDisconnectedMessage() RoomDisconnectedMessage {
@@ -67,16 +151,44 @@ func newGameFinishedMessage(result GameResult) GameFinishedMessage {
 	return GameFinishedMessage{ServerGameFinished, result}
 }
 
+func newTurnDeadlineMessage(turn int, deadline time.Time) TurnDeadlineMessage {
+	return TurnDeadlineMessage{ServerTurnDeadline, turn, deadline.UnixMilli()}
+}
+
+func newSeriesUpdateMessage(series SeriesStatus) SeriesUpdateMessage {
+	return SeriesUpdateMessage{ServerSeriesUpdate, series}
+}
+
+func newErrorMessage(code ErrorCode, detail string) ErrorMessage {
+	return ErrorMessage{ServerError, code, detail}
+}
+
+func newShutdownMessage(deadline time.Time) ShutdownMessage {
+	return ShutdownMessage{ServerShutdown, deadline.UnixMilli()}
+}
+
+func newNoticeMessage(text string) NoticeMessage {
+	return NoticeMessage{ServerNotice, text}
+}
+
 type ClientMessageType int
 
 const (
-	ClientJoinRoom ClientMessageType = 1
-	ClientSendTurn ClientMessageType = 2
-	ClientQuitRoom ClientMessageType = 3
+	ClientJoinRoom  ClientMessageType = 1
+	ClientSendTurn  ClientMessageType = 2
+	ClientQuitRoom  ClientMessageType = 3
+	ClientFindMatch ClientMessageType = 4
+	ClientReconnect ClientMessageType = 5
+	ClientSpectate  ClientMessageType = 6
+	ClientRematch   ClientMessageType = 7
+	ClientPlayBot   ClientMessageType = 8
 )
 
 type ClientMessage struct {
 	Type     ClientMessageType `json:"type"`
 	Actions  []TankAction      `json:"Actions"`
 	RoomCode string            `json:"roomCode"`
+	Token    string            `json:"token"`
+	// only used by the player creating the room
+	Options RoomOptions `json:"options"`
 }
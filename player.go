@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -11,10 +12,57 @@ import (
 type PlayerMessageType int
 
 const (
-	PlayerSendTurn PlayerMessageType = 1
-	PlayerQuitRoom PlayerMessageType = 2
+	PlayerSendTurn     PlayerMessageType = 1
+	PlayerQuitRoom     PlayerMessageType = 2
+	PlayerDisconnected PlayerMessageType = 3
+	PlayerRematch      PlayerMessageType = 4
 )
 
+const playerNoticesSize = 8
+
+type PlayerSettings struct {
+	// zero disables pings
+	pingInterval time.Duration
+	// how long the connection may stay silent, must exceed pingInterval, zero
+	// never times out
+	pongWait time.Duration
+	// zero never times out
+	writeWait      time.Duration
+	maxMessageSize int64
+	// messages waiting to be written, a client that falls further behind is
+	// disconnected
+	sendQueue int
+}
+
+func NewDefaultPlayerSettings() PlayerSettings {
+	return PlayerSettings{
+		pingInterval:   25 * time.Second,
+		pongWait:       60 * time.Second,
+		writeWait:      10 * time.Second,
+		maxMessageSize: 64 * 1024,
+		sendQueue:      64,
+	}
+}
+
+func (s PlayerSettings) validate() error {
+	if s.pingInterval < 0 || s.pongWait < 0 || s.writeWait < 0 {
+		return errors.New("durations cant be negative")
+	}
+	if s.pongWait > 0 && s.pingInterval == 0 {
+		return errors.New("pong wait needs pings enabled")
+	}
+	if s.pongWait > 0 && s.pingInterval >= s.pongWait {
+		return errors.New("ping interval must be shorter than pong wait")
+	}
+	if s.maxMessageSize <= 0 {
+		return errors.New("max message size must be positive")
+	}
+	if s.sendQueue <= 0 {
+		return errors.New("send queue must be positive")
+	}
+	return nil
+}
+
 type RoomChans struct {
 	// player reads, room writes
 	read chan RoomMessage
@@ -38,19 +86,38 @@ type Player struct {
 
 	conn     *websocket.Conn
 	wsClosed bool
-
-	roomRequests chan RoomRequest
-	clientRead   chan ClientMessage
-	room         RoomChans
+	settings PlayerSettings
+	// written by writePump so a slow client never blocks the room
+	outbox chan ServerMessage
+	// messages from the hub meant for every connection
+	notices chan ServerMessage
+	// read by writePump ahead of the outbox, so the hub can always hang up
+	disconnects chan closeFrame
+
+	spectating bool
+
+	hub        *Hub
+	clientRead chan ClientMessage
+	// details of messages readPump couldnt decode
+	clientInvalid chan string
+	room          RoomChans
 
 	done chan struct{}
+	// closed once the matchmaking request reached the hub, nil when the
+	// player isnt queued
+	matchRequested chan struct{}
 }
 
-func NewPlayer(conn *websocket.Conn, roomRequests chan RoomRequest) *Player {
+func NewPlayer(conn *websocket.Conn, hub *Hub) *Player {
 	p := &Player{
-		conn:         conn,
-		roomRequests: roomRequests,
-		clientRead:   make(chan ClientMessage),
+		conn:          conn,
+		settings:      hub.playerSettings,
+		outbox:        make(chan ServerMessage, hub.playerSettings.sendQueue),
+		notices:       make(chan ServerMessage, playerNoticesSize),
+		disconnects:   make(chan closeFrame, 1),
+		hub:           hub,
+		clientRead:    make(chan ClientMessage),
+		clientInvalid: make(chan string),
 	}
 	p.notInRoom = PlayerStateNotInRoom{p}
 	p.waitingForRoom = PlayerStateWaitingForRoom{p}
@@ -63,17 +130,40 @@ func NewPlayer(conn *websocket.Conn, roomRequests chan RoomRequest) *Player {
 
 func (p *Player) Run() {
 	go p.readPump()
+	go p.writePump()
 	defer fmt.Println("player goroutine exited")
+	defer close(p.outbox)
+	defer func() {
+		p.hub.unregister <- p
+	}()
+
+	for !p.runUntilFault() {
+	}
+}
+
+// runUntilFault returns false when a handler panicked, the player is failed
+// by then and waits for its connection and room to close.
+func (p *Player) runUntilFault() (done bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			p.fail(newPanicError(v))
+		}
+	}()
+
 	for {
 		select {
 		case cm, ok := <-p.clientRead:
 			if p.state.handleClientMessage(cm, ok) {
-				return
+				return true
 			}
 		case rm, ok := <-p.room.read:
 			if p.state.handleRoomMessage(rm, ok) {
-				return
+				return true
 			}
+		case detail := <-p.clientInvalid:
+			p.reject(ErrInvalidMessage, detail)
+		case msg := <-p.notices:
+			p.Write(msg)
 		}
 	}
 }
@@ -82,17 +172,180 @@ func (p *Player) setState(state PlayerState) {
 	p.state = state
 }
 
+// Write queues msg for writePump, a client whose queue is full is too slow to
+// keep up and gets disconnected.
 func (p *Player) Write(msg ServerMessage) error {
 	if p.wsClosed {
 		return errors.New("conn closed")
 	}
-	err := p.conn.WriteJSON(msg)
-	if err != nil {
+	select {
+	case p.outbox <- msg:
+		return nil
+	default:
 		p.wsClosed = true
 		p.conn.Close()
-		return err
+		return errors.New("send queue full")
 	}
-	return nil
+}
+
+// closeFrame makes writePump send a close frame and hang up once the
+// messages queued before it are written.
+type closeFrame struct {
+	code int
+	text string
+}
+
+func (m closeFrame) isServerMessage() {}
+
+func (p *Player) hangUp(code int, text string) {
+	p.Write(closeFrame{code, text})
+	p.wsClosed = true
+}
+
+// writePump owns all writes to the connection. A failed write closes the
+// connection, readPump then reports the disconnect, and the rest of the queue
+// is dropped.
+func (p *Player) writePump() {
+	var pings <-chan time.Time
+	if p.settings.pingInterval > 0 {
+		ticker := time.NewTicker(p.settings.pingInterval)
+		defer ticker.Stop()
+		pings = ticker.C
+	}
+
+	failed := false
+	for {
+		// a disconnect from the hub goes out before anything still queued
+		select {
+		case cf := <-p.disconnects:
+			if !failed {
+				p.writeClose(cf)
+				failed = true
+			}
+			continue
+		default:
+		}
+
+		var err error
+		select {
+		case msg, ok := <-p.outbox:
+			if !ok {
+				return
+			}
+			if failed {
+				continue
+			}
+			if cf, ok := msg.(closeFrame); ok {
+				p.writeClose(cf)
+				failed = true
+				continue
+			}
+			p.conn.SetWriteDeadline(p.writeDeadline())
+			err = p.conn.WriteJSON(msg)
+		case cf := <-p.disconnects:
+			if !failed {
+				p.writeClose(cf)
+				failed = true
+			}
+			continue
+		case <-pings:
+			if failed {
+				continue
+			}
+			err = p.conn.WriteControl(websocket.PingMessage, nil, p.writeDeadline())
+		}
+		if err != nil {
+			failed = true
+			p.conn.Close()
+		}
+	}
+}
+
+func (p *Player) writeClose(cf closeFrame) {
+	data := websocket.FormatCloseMessage(cf.code, cf.text)
+	p.conn.WriteControl(websocket.CloseMessage, data, p.writeDeadline())
+	p.conn.Close()
+}
+
+func (p *Player) writeDeadline() time.Time {
+	if p.settings.writeWait == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(p.settings.writeWait)
+}
+
+// extendRead pushes the read deadline back, a connection that stays silent
+// past it counts as dropped.
+func (p *Player) extendRead() {
+	if p.settings.pongWait == 0 {
+		return
+	}
+	p.conn.SetReadDeadline(time.Now().Add(p.settings.pongWait))
+}
+
+// notify never blocks the hub, a connection too far behind misses the
+// notice.
+func (p *Player) notify(msg ServerMessage) {
+	select {
+	case p.notices <- msg:
+	default:
+	}
+}
+
+// disconnect sends a close frame ahead of everything still queued, it never
+// blocks the hub.
+func (p *Player) disconnect(code int, text string) {
+	select {
+	case p.disconnects <- closeFrame{code, text}:
+	default:
+	}
+}
+
+// reject tells the client why its message was ignored. A failed write closes
+// the connection, readPump then reports the disconnect as usual.
+func (p *Player) reject(code ErrorCode, detail string) {
+	p.Write(newErrorMessage(code, detail))
+}
+
+func (p *Player) sendRoom(msg PlayerMessage) {
+	ch := p.room.send
+	done := p.done
+	go func(ch chan PlayerMessage, done chan struct{}) {
+		select {
+		case ch <- msg:
+		case <-done:
+		}
+	}(ch, done)
+}
+
+func (p *Player) quitRoom() {
+	p.sendRoom(PlayerMessage{msgType: PlayerQuitRoom})
+	if p.matchRequested == nil {
+		return
+	}
+	chans := p.room
+	sent := p.matchRequested
+	p.matchRequested = nil
+	go func(chans RoomChans, sent chan struct{}) {
+		<-sent
+		p.hub.matchCancels <- chans
+	}(chans, sent)
+}
+
+// disconnectRoom lets a running room hold the seat for a reconnect instead of
+// forfeiting the game.
+func (p *Player) disconnectRoom() {
+	p.sendRoom(PlayerMessage{msgType: PlayerDisconnected})
+}
+
+func (p *Player) newRoomChans() RoomChans {
+	chans := RoomChans{
+		read: make(chan RoomMessage),
+		send: make(chan PlayerMessage),
+	}
+	p.room = chans
+	p.done = make(chan struct{})
+	return chans
 }
 
 func (p *Player) readPump() {
@@ -101,19 +354,29 @@ func (p *Player) readPump() {
 		close(p.clientRead)
 	}()
 
+	p.conn.SetReadLimit(p.settings.maxMessageSize)
+	p.extendRead()
+	p.conn.SetPongHandler(func(string) error {
+		p.extendRead()
+		return nil
+	})
+
 	for {
 		msgType, msg, err := p.conn.ReadMessage()
 		if err != nil {
 			return
 		}
+		p.extendRead()
 		if msgType != websocket.TextMessage {
-			return
+			p.clientInvalid <- "only text messages are supported"
+			continue
 		}
 
 		clientMsg := ClientMessage{}
 		err = json.Unmarshal(msg, &clientMsg)
 		if err != nil {
-			return
+			p.clientInvalid <- err.Error()
+			continue
 		}
 
 		p.clientRead <- clientMsg
@@ -135,32 +398,56 @@ func (ps PlayerStateNotInRoom) handleClientMessage(cm ClientMessage, ok bool) bo
 		return true
 	}
 	switch cm.Type {
-	case ClientJoinRoom:
-		chans := RoomChans{
-			read: make(chan RoomMessage),
-			send: make(chan PlayerMessage),
+	case ClientJoinRoom, ClientReconnect, ClientSpectate:
+		chans := ps.player.newRoomChans()
+		req := RoomRequest{
+			code:     cm.RoomCode,
+			spectate: cm.Type == ClientSpectate,
+			options:  cm.Options,
+			chans:    chans,
 		}
-		ps.player.room = chans
-		ps.player.done = make(chan struct{})
+		if cm.Type == ClientReconnect {
+			req.token = cm.Token
+		}
+		ps.player.spectating = req.spectate
 
-		go func(chans RoomChans) {
-			ps.player.roomRequests <- RoomRequest{
-				code:  cm.RoomCode,
-				chans: chans,
-			}
-		}(chans)
+		go func(req RoomRequest) {
+			ps.player.hub.roomRequests <- req
+		}(req)
 
 		ps.player.setState(ps.player.waitingForRoom)
-	case ClientQuitRoom:
-		fmt.Println("illegal")
-	case ClientSendTurn:
-		fmt.Println("illegal")
+	case ClientPlayBot:
+		chans := ps.player.newRoomChans()
+		ps.player.spectating = false
+
+		go func(req RoomRequest) {
+			ps.player.hub.botRequests <- req
+		}(RoomRequest{options: cm.Options, chans: chans})
+
+		ps.player.setState(ps.player.waitingForRoom)
+	case ClientFindMatch:
+		chans := ps.player.newRoomChans()
+		ps.player.spectating = false
+		sent := make(chan struct{})
+		ps.player.matchRequested = sent
+
+		go func(chans RoomChans, sent chan struct{}) {
+			ps.player.hub.matchRequests <- chans
+			close(sent)
+		}(chans, sent)
+
+		ps.player.setState(ps.player.waitingForRoom)
+	case ClientQuitRoom, ClientSendTurn, ClientRematch:
+		ps.player.reject(ErrNotInRoom, "join a room first")
+	default:
+		ps.player.reject(ErrUnknownMessage, fmt.Sprintf("unknown message type %d", cm.Type))
 	}
 	return false
 }
 
 func (ps PlayerStateNotInRoom) handleRoomMessage(rm RoomMessage, ok bool) bool {
-	panic("shouldnt receive from room while in PlayerStateNotInRoom")
+	ps.player.fail(newInvariantError(ps, "room message"))
+	return false
 }
 
 type PlayerStateWaitingForRoom struct {
@@ -170,36 +457,25 @@ type PlayerStateWaitingForRoom struct {
 func (ps PlayerStateWaitingForRoom) handleClientMessage(cm ClientMessage, ok bool) bool {
 	if !ok {
 		ps.player.clientRead = nil
-		ch := ps.player.room.send
-		done := ps.player.done
-		go func(ch chan PlayerMessage, done chan struct{}) {
-			select {
-			case ch <- PlayerMessage{msgType: PlayerQuitRoom}:
-			case <-done:
-			}
-		}(ch, done)
+		ps.player.quitRoom()
 		ps.player.setState(ps.player.waitForClose)
 		return false
 	}
 	switch cm.Type {
-	case ClientJoinRoom:
-		fmt.Println("illegal")
+	case ClientJoinRoom, ClientFindMatch, ClientReconnect, ClientSpectate, ClientPlayBot:
+		ps.player.reject(ErrAlreadyInRoom, "already joining a room")
 	case ClientQuitRoom:
-		ch := ps.player.room.send
-		done := ps.player.done
-		go func(ch chan PlayerMessage, done chan struct{}) {
-			select {
-			case ch <- PlayerMessage{msgType: PlayerQuitRoom}:
-			case <-done:
-			}
-		}(ch, done)
-	case ClientSendTurn:
-		fmt.Println("illegal")
+		ps.player.quitRoom()
+	case ClientSendTurn, ClientRematch:
+		ps.player.reject(ErrNotInRoom, "still joining a room")
+	default:
+		ps.player.reject(ErrUnknownMessage, fmt.Sprintf("unknown message type %d", cm.Type))
 	}
 	return false
 }
 
 func (ps PlayerStateWaitingForRoom) handleRoomMessage(rm RoomMessage, ok bool) bool {
+	ps.player.matchRequested = nil
 	if !ok {
 		close(ps.player.done)
 		ps.player.done = nil
@@ -214,27 +490,18 @@ func (ps PlayerStateWaitingForRoom) handleRoomMessage(rm RoomMessage, ok bool) b
 	}
 
 	switch rm.msgType {
+	case RoomError:
+		ps.player.reject(rm.errCode, rm.detail)
 	case RoomJoined:
 		ps.player.setState(ps.player.inRoom)
-		err := ps.player.Write(newRoomJoinedMessage())
+		err := ps.player.Write(newRoomJoinedMessage(rm.code))
 		if err != nil {
-			ch := ps.player.room.send
-			done := ps.player.done
-			go func(ch chan PlayerMessage, done chan struct{}) {
-				select {
-				case ch <- PlayerMessage{msgType: PlayerQuitRoom}:
-				case <-done:
-				}
-			}(ch, done)
+			ps.player.quitRoom()
 			ps.player.setState(ps.player.waitForClose)
 			return false
 		}
-	case RoomGameStarted:
-		panic("game shouldnt start before joining room")
-	case RoomTurnResult:
-		panic("shouldnt rececive turn result before joining room")
-	case RoomGameFinished:
-		panic("shouldnt rececive game finished before joining room")
+	default:
+		ps.player.fail(newInvariantError(ps, fmt.Sprintf("room message %d", rm.msgType)))
 	}
 	return false
 }
@@ -246,42 +513,32 @@ type PlayerStateInRoom struct {
 func (ps PlayerStateInRoom) handleClientMessage(cm ClientMessage, ok bool) bool {
 	if !ok {
 		ps.player.clientRead = nil
-		ch := ps.player.room.send
-		done := ps.player.done
-		go func(ch chan PlayerMessage, done chan struct{}) {
-			select {
-			case ch <- PlayerMessage{msgType: PlayerQuitRoom}:
-			case <-done:
-			}
-		}(ch, done)
+		ps.player.disconnectRoom()
 		ps.player.setState(ps.player.waitForClose)
 		return false
 	}
 	switch cm.Type {
-	case ClientJoinRoom:
-		fmt.Println("illegal")
+	case ClientJoinRoom, ClientFindMatch, ClientReconnect, ClientSpectate, ClientPlayBot:
+		ps.player.reject(ErrAlreadyInRoom, "quit the current room first")
 	case ClientQuitRoom:
-		ch := ps.player.room.send
-		done := ps.player.done
-		go func(ch chan PlayerMessage, done chan struct{}) {
-			select {
-			case ch <- PlayerMessage{msgType: PlayerQuitRoom}:
-			case <-done:
-			}
-		}(ch, done)
+		ps.player.quitRoom()
+	case ClientRematch:
+		if ps.player.spectating {
+			ps.player.reject(ErrSpectator, "spectators cant accept rematches")
+			break
+		}
+		ps.player.sendRoom(PlayerMessage{msgType: PlayerRematch})
 	case ClientSendTurn:
-		ch := ps.player.room.send
-		done := ps.player.done
-		go func(ch chan PlayerMessage, done chan struct{}) {
-			msg := PlayerMessage{
-				msgType:     PlayerSendTurn,
-				tankActions: cm.Actions,
-			}
-			select {
-			case ch <- msg:
-			case <-done:
-			}
-		}(ch, done)
+		if ps.player.spectating {
+			ps.player.reject(ErrSpectator, "spectators cant send turns")
+			break
+		}
+		ps.player.sendRoom(PlayerMessage{
+			msgType:     PlayerSendTurn,
+			tankActions: cm.Actions,
+		})
+	default:
+		ps.player.reject(ErrUnknownMessage, fmt.Sprintf("unknown message type %d", cm.Type))
 	}
 	return false
 }
@@ -306,24 +563,24 @@ func (ps PlayerStateInRoom) handleRoomMessage(rm RoomMessage, ok bool) bool {
 
 	switch rm.msgType {
 	case RoomJoined:
-		panic("shouldnt receive room joined message while in room")
+		ps.player.fail(newInvariantError(ps, "room joined"))
+		return false
 	case RoomGameStarted:
-		err = ps.player.Write(newStartGameMessage(rm.config))
+		err = ps.player.Write(newStartGameMessage(rm.config, rm.token))
 	case RoomTurnResult:
 		err = ps.player.Write(newTurnResultsMessage(rm.turnResults))
 	case RoomGameFinished:
 		err = ps.player.Write(newGameFinishedMessage(rm.gameResult))
+	case RoomTurnDeadline:
+		err = ps.player.Write(newTurnDeadlineMessage(rm.turn, rm.deadline))
+	case RoomSeriesUpdate:
+		err = ps.player.Write(newSeriesUpdateMessage(rm.series))
+	case RoomError:
+		err = ps.player.Write(newErrorMessage(rm.errCode, rm.detail))
 	}
 
 	if err != nil {
-		ch := ps.player.room.send
-		done := ps.player.done
-		go func(ch chan PlayerMessage, done chan struct{}) {
-			select {
-			case ch <- PlayerMessage{msgType: PlayerQuitRoom}:
-			case <-done:
-			}
-		}(ch, done)
+		ps.player.disconnectRoom()
 		ps.player.setState(ps.player.waitForClose)
 	}
 	return false
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSlowConsumerIsDisconnected(t *testing.T) {
+	rs := NewDefaultRoomSettings()
+	rs.turnTimeout = 10 * time.Millisecond
+	rs.maxTimeouts = 0
+	rs.reconnectGrace = time.Minute
+	ps := NewDefaultPlayerSettings()
+	ps.pingInterval = 0
+	ps.pongWait = 0
+	ps.writeWait = time.Minute
+	ps.sendQueue = 4
+	gc := NewBasicConfig(false, true)
+	gc.shrinkAfter = 1000000
+	hub := NewHub(NewDefaultHubSettings(), rs, ps, map[string]GameConfig{DefaultMapName: gc})
+	go hub.Run()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", hub.ServeWs)
+	srv := httptest.NewUnstartedServer(mux)
+	// small socket buffers so the stalled client backs up into the send queue
+	srv.Config.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		c.(*net.TCPConn).SetWriteBuffer(1024)
+		return ctx
+	}
+	srv.Start()
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	active := dialTest(t, websocket.DefaultDialer, url)
+	stalled := dialTest(t, &websocket.Dialer{NetDial: func(network, addr string) (net.Conn, error) {
+		c, err := net.Dial(network, addr)
+		if err == nil {
+			c.(*net.TCPConn).SetReadBuffer(1024)
+		}
+		return c, err
+	}}, url)
+	defer active.Close()
+	defer stalled.Close()
+
+	join := ClientMessage{Type: ClientJoinRoom, RoomCode: "slow"}
+	for _, c := range []*websocket.Conn{active, stalled} {
+		if err := c.WriteJSON(join); err != nil {
+			t.Fatal(err)
+		}
+		expectMessage(t, c, ServerRoomJoined)
+	}
+	for _, c := range []*websocket.Conn{active, stalled} {
+		expectMessage(t, c, ServerStartGame)
+	}
+
+	// every turn times out, the stalled client stops reading from here on and
+	// falls far enough behind to overflow its queue
+	for range 200 {
+		expectMessage(t, active, ServerTurnResults)
+	}
+
+	// whatever was buffered drains, then the stalled connection is gone
+	stalled.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := stalled.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			t.Fatal("stalled connection was not closed")
+		}
+		break
+	}
+
+	// the other player keeps playing
+	for range 5 {
+		expectMessage(t, active, ServerTurnResults)
+	}
+}
+
+func dialTest(t *testing.T, d *websocket.Dialer, url string) *websocket.Conn {
+	t.Helper()
+	c, _, err := d.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func expectMessage(t *testing.T, c *websocket.Conn, typ ServerMessageType) {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		_, b, err := c.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for message %d: %v", typ, err)
+		}
+		var m struct {
+			Type ServerMessageType `json:"type"`
+		}
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Type == typ {
+			return
+		}
+	}
+}
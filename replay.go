@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const ReplayVersion = 1
+
+type ReplayTurn struct {
+	P1 []TankAction `json:"p1"`
+	P2 []TankAction `json:"p2"`
+	// results as sent to each seat, compared verbatim when re-simulating
+	ResultsP1 json.RawMessage `json:"resultsP1"`
+	ResultsP2 json.RawMessage `json:"resultsP2"`
+}
+
+// Replay holds everything needed to re-run one game, the seats are the room's
+// players while the map keeps its own spawn order.
+type Replay struct {
+	Version int       `json:"version"`
+	Room    string    `json:"room"`
+	Game    int       `json:"game"`
+	Started time.Time `json:"started"`
+	Map     MapConfig `json:"map"`
+	// seat 1 plays the second spawn list
+	Swapped  bool         `json:"swapped"`
+	P1First  bool         `json:"p1First"`
+	Turns    []ReplayTurn `json:"turns"`
+	ResultP1 GameResult   `json:"resultP1"`
+}
+
+func NewReplay(room string, game int, gc GameConfig, swapped, p1First bool) *Replay {
+	return &Replay{
+		Version: ReplayVersion,
+		Room:    room,
+		Game:    game,
+		Started: time.Now().UTC(),
+		Map:     gc.MapConfig(),
+		Swapped: swapped,
+		P1First: p1First,
+		Turns:   []ReplayTurn{},
+	}
+}
+
+func (rp *Replay) record(p1, p2 []TankAction, results1, results2 []TurnResult) error {
+	raw1, err := json.Marshal(results1)
+	if err != nil {
+		return err
+	}
+	raw2, err := json.Marshal(results2)
+	if err != nil {
+		return err
+	}
+	rp.Turns = append(rp.Turns, ReplayTurn{p1, p2, raw1, raw2})
+	return nil
+}
+
+func (rp *Replay) Save(dir string) (string, error) {
+	data, err := json.MarshalIndent(rp, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%d-%d.json", rp.Started.UnixNano(), rp.Game)
+	path := filepath.Join(dir, name)
+	return path, os.WriteFile(path, data, 0o644)
+}
+
+func LoadReplay(path string) (*Replay, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rp := &Replay{}
+	if err := json.Unmarshal(data, rp); err != nil {
+		return nil, err
+	}
+	if rp.Version != ReplayVersion {
+		return nil, fmt.Errorf("unsupported replay version %d", rp.Version)
+	}
+	return rp, nil
+}
+
+func (rp *Replay) GameConfig() (GameConfig, error) {
+	gc, err := rp.Map.GameConfig()
+	if err != nil {
+		return GameConfig{}, err
+	}
+	return gc.withSides(rp.Swapped, rp.P1First), nil
+}
+
+// Simulate re-runs every turn and fails at the first turn whose results
+// differ from the recorded ones.
+func (rp *Replay) Simulate() (*GameState, error) {
+	gc, err := rp.GameConfig()
+	if err != nil {
+		return nil, err
+	}
+	gs := NewGameState(gc)
+	for i, turn := range rp.Turns {
+		results1, results2 := gs.ResolveActions(turn.P1, turn.P2)
+		if err := sameResults(turn.ResultsP1, results1); err != nil {
+			return gs, fmt.Errorf("turn %d, seat 1: %w", i+1, err)
+		}
+		if err := sameResults(turn.ResultsP2, results2); err != nil {
+			return gs, fmt.Errorf("turn %d, seat 2: %w", i+1, err)
+		}
+	}
+	return gs, nil
+}
+
+var errResultsDiffer = errors.New("results differ from the recording")
+
+func sameResults(recorded json.RawMessage, results []TurnResult) error {
+	got, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	want := bytes.Buffer{}
+	if err := json.Compact(&want, recorded); err != nil {
+		return err
+	}
+	if !bytes.Equal(want.Bytes(), got) {
+		return fmt.Errorf("%w:\nrecorded %s\ngot      %s", errResultsDiffer, want.Bytes(), got)
+	}
+	return nil
+}
+
+// runReplay implements `tank-ops replay file...`, it re-simulates each
+// replay and exits non-zero when any of them diverges.
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "replay: no files given")
+		return 2
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		rp, err := LoadReplay(path)
+		if err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		gs, err := rp.Simulate()
+		if err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		resultP1, _, finished := gs.Result()
+		if finished && resultP1 != rp.ResultP1 {
+			fmt.Printf("%s: recorded result %d, got %d\n", path, rp.ResultP1, resultP1)
+			failed = true
+			continue
+		}
+		fmt.Printf(
+			"%s: ok, room %s game %d, %d turns, seat 1 result %d\n",
+			path, rp.Room, rp.Game+1, len(rp.Turns), rp.ResultP1,
+		)
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
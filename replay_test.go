@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestReplayRoundTrip(t *testing.T) {
+	classes := []string{"scout", "main_battle_tank", "artillery", "tank_destroyer"}
+	dir := t.TempDir()
+	for seed := uint64(1); seed <= 20; seed++ {
+		params := NewDefaultMapGenParams(seed)
+		params.Tanks = 4
+		params.Classes = classes
+		gc, err := GenerateMap(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		swap, p1First := sides(int(seed))
+		rp := NewReplay("test", int(seed), gc, swap, p1First)
+		gs := NewGameState(gc.withSides(swap, p1First))
+		cfg1, cfg2 := gs.ClientConfigs()
+		b1, b2 := NewBot(), NewBot()
+		b1.reset(cfg1)
+		b2.reset(cfg2)
+
+		for range 200 {
+			a1, a2 := b1.actions(), b2.actions()
+			results1, results2 := gs.ResolveActions(a1, a2)
+			b1.apply(results1)
+			b2.apply(results2)
+			if err := rp.record(a1, a2, results1, results2); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, over := gs.Result(); over {
+				break
+			}
+		}
+		rp.ResultP1, _, _ = gs.Result()
+
+		path, err := rp.Save(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadReplay(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		simulated, err := loaded.Simulate()
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		if resultP1, _, _ := simulated.Result(); resultP1 != rp.ResultP1 {
+			t.Errorf("seed %d: simulated result %d, recorded %d", seed, resultP1, rp.ResultP1)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package main
 
-import "fmt"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
 
 type RoomMessageType int
 
@@ -9,13 +14,73 @@ const (
 	RoomGameStarted  RoomMessageType = 2
 	RoomGameFinished RoomMessageType = 3
 	RoomTurnResult   RoomMessageType = 4
+	RoomTurnDeadline RoomMessageType = 5
+	RoomSeriesUpdate RoomMessageType = 6
+	RoomError        RoomMessageType = 7
 )
 
 type RoomMessage struct {
 	msgType     RoomMessageType
+	code        string
+	token       string
 	config      ClientConfig
 	turnResults []TurnResult
 	gameResult  GameResult
+	turn        int
+	deadline    time.Time
+	series      SeriesStatus
+	errCode     ErrorCode
+	detail      string
+}
+
+type RoomSettings struct {
+	reconnectGrace time.Duration
+	// zero disables the turn timer
+	turnTimeout time.Duration
+	// consecutive timeouts after which a player forfeits, zero never forfeits
+	maxTimeouts int
+	// finished games are saved here, empty disables replays
+	replayDir string
+	// dumps of failed rooms are saved here, empty prints them
+	dumpDir string
+	// games running at shutdown are saved here, empty prints them
+	checkpointDir string
+	// zero is unlimited
+	maxSpectators int
+	// fills in whatever the room creator leaves out
+	defaultOptions RoomOptions
+}
+
+func NewDefaultRoomSettings() RoomSettings {
+	return RoomSettings{
+		reconnectGrace: 30 * time.Second,
+		turnTimeout:    60 * time.Second,
+		maxTimeouts:    3,
+		defaultOptions: RoomOptions{}.normalized(),
+	}
+}
+
+type Seat struct {
+	token     string
+	results   [][]TurnResult
+	reconnect *time.Timer
+	timeouts  int
+	rematch   bool
+}
+
+func (s *Seat) expired() <-chan time.Time {
+	if s.reconnect == nil {
+		return nil
+	}
+	return s.reconnect.C
+}
+
+func (s *Seat) stopReconnect() {
+	if s.reconnect == nil {
+		return
+	}
+	s.reconnect.Stop()
+	s.reconnect = nil
 }
 
 type QueuedActions struct {
@@ -27,47 +92,122 @@ type Room struct {
 	waitingForP1 RoomStateWaitingForP1
 	waitingForP2 RoomStateWaitingForP2
 	running      RoomStateRunning
+	postGame     RoomStatePostGame
 	closing      RoomStateClosing
 	state        RoomState
 
-	code     string
-	requests chan RoomRequest
-	close    chan string
+	code       string
+	settings   RoomSettings
+	gameConfig GameConfig
+	requests   chan RoomRequest
+	close      chan *Room
+	// closed by the hub when the server shuts down, stop once running games
+	// have run out of time
+	drain    chan struct{}
+	stop     chan struct{}
+	draining bool
+	// admin requests, answered on the room goroutine
+	summaries   chan chan RoomSummary
+	dumps       chan chan RoomDump
+	adminCloses chan string
+	// closed once Run returns
+	done chan struct{}
 
 	player1chans RoomChans
 	player2chans RoomChans
+	seatP1       Seat
+	seatP2       Seat
+	options      RoomOptions
+	series       Series
+
+	spectators       []*Spectator
+	spectatorLeft    chan *Spectator
+	spectatorResults [][]TurnResult
 
 	gamestate *GameState
+	replay    *Replay
 
 	queuedP1 QueuedActions
 	queuedP2 QueuedActions
+
+	turnTimer    *time.Timer
+	turnDeadline time.Time
 }
 
-func NewRoom(code string, close chan string) *Room {
+func NewRoom(code string, settings RoomSettings, gameConfig GameConfig, close chan *Room) *Room {
 	requests := make(chan RoomRequest)
 	room := &Room{
-		code:     code,
-		requests: requests,
-		close:    close,
+		code:          code,
+		settings:      settings,
+		gameConfig:    gameConfig,
+		requests:      requests,
+		close:         close,
+		drain:         make(chan struct{}),
+		stop:          make(chan struct{}),
+		summaries:     make(chan chan RoomSummary),
+		dumps:         make(chan chan RoomDump),
+		adminCloses:   make(chan string),
+		done:          make(chan struct{}),
+		spectatorLeft: make(chan *Spectator),
 	}
 	room.waitingForP1 = RoomStateWaitingForP1{room}
 	room.waitingForP2 = RoomStateWaitingForP2{room}
 	room.running = RoomStateRunning{room}
+	room.postGame = RoomStatePostGame{room}
+	room.closing = RoomStateClosing{room}
 	room.state = room.waitingForP1
 	return room
 }
 
 func (r *Room) Run() {
+	defer close(r.done)
+	for !r.runUntilFault() {
+	}
+}
+
+// runUntilFault returns false when a handler panicked, the room is failed by
+// then and keeps running until the hub closes it.
+func (r *Room) runUntilFault() (done bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			r.fail(newPanicError(v))
+		}
+	}()
+
 	for {
 		select {
 		case joinRequest, ok := <-r.requests:
 			if r.state.handleJoinRequest(joinRequest, ok) {
-				return
+				return true
 			}
 		case msg := <-r.player1chans.send:
 			r.state.handlePlayerMessage(msg, true)
 		case msg := <-r.player2chans.send:
 			r.state.handlePlayerMessage(msg, false)
+		case <-r.seatP1.expired():
+			r.seatP1.reconnect = nil
+			r.state.handleSeatExpired(true)
+		case <-r.seatP2.expired():
+			r.seatP2.reconnect = nil
+			r.state.handleSeatExpired(false)
+		case <-r.turnExpired():
+			r.turnTimer = nil
+			r.state.handleTurnTimeout()
+		case s := <-r.spectatorLeft:
+			r.removeSpectator(s)
+		case <-r.drain:
+			r.drain = nil
+			r.draining = true
+			r.state.handleDrain()
+		case <-r.stop:
+			r.stop = nil
+			r.state.handleStop()
+		case reply := <-r.summaries:
+			reply <- r.summary()
+		case reply := <-r.dumps:
+			reply <- r.dump(nil)
+		case reason := <-r.adminCloses:
+			r.state.handleAdminClose(reason)
 		}
 	}
 }
@@ -76,6 +216,264 @@ func (r *Room) setState(state RoomState) {
 	r.state = state
 }
 
+func (r *Room) playerChans(isP1 bool) (*RoomChans, *Seat) {
+	if isP1 {
+		return &r.player1chans, &r.seatP1
+	}
+	return &r.player2chans, &r.seatP2
+}
+
+// sendPlayer is a no-op for a seat whose player is disconnected and may still
+// reclaim it.
+func (r *Room) sendPlayer(isP1 bool, msg RoomMessage) {
+	chans, _ := r.playerChans(isP1)
+	if chans.read == nil {
+		return
+	}
+	chans.read <- msg
+}
+
+func (r *Room) sendTurnResults(isP1 bool, results []TurnResult) {
+	_, seat := r.playerChans(isP1)
+	seat.results = append(seat.results, results)
+	r.sendPlayer(isP1, RoomMessage{
+		msgType:     RoomTurnResult,
+		turnResults: results,
+	})
+}
+
+func (r *Room) rejectPlayer(isP1 bool, code ErrorCode, detail string) {
+	r.sendPlayer(isP1, RoomMessage{msgType: RoomError, errCode: code, detail: detail})
+}
+
+// rejectRequest tells the requester why it cant join before closing its
+// channel.
+func rejectRequest(chans RoomChans, code ErrorCode, detail string) {
+	chans.read <- RoomMessage{msgType: RoomError, errCode: code, detail: detail}
+	close(chans.read)
+}
+
+func (r *Room) closePlayer(isP1 bool) {
+	chans, seat := r.playerChans(isP1)
+	seat.stopReconnect()
+	if chans.read != nil {
+		close(chans.read)
+	}
+	chans.read = nil
+	chans.send = nil
+}
+
+func (r *Room) requestClose() {
+	ch := r.close
+	go func(ch chan *Room) {
+		ch <- r
+	}(ch)
+}
+
+// sides says who plays which spawns and moves first in a game of the series,
+// the first game is played as the map is laid out with the second seat moving
+// first, and every game after swaps both.
+func sides(game int) (swapPlayers, p1First bool) {
+	swap := game%2 == 1
+	return swap, swap
+}
+
+// startGame starts the next game of the series, players swap sides and the
+// first move every game.
+func (r *Room) startGame() {
+	r.seatP1 = Seat{token: newReconnectToken()}
+	r.seatP2 = Seat{token: newReconnectToken()}
+	r.ClearActions()
+
+	swap, p1First := sides(r.series.game)
+	cfg := r.gameConfig.withSides(swap, p1First)
+	if err := cfg.validate(); err != nil {
+		fmt.Println("room: invalid map:", err)
+		r.rejectPlayer(true, ErrInvalidMap, err.Error())
+		r.rejectPlayer(false, ErrInvalidMap, err.Error())
+		r.closeRoom()
+		return
+	}
+	r.gamestate = NewGameState(cfg)
+	if r.settings.replayDir != "" {
+		r.replay = NewReplay(r.code, r.series.game, r.gameConfig, swap, p1First)
+	}
+	cfg1, cfg2 := r.gamestate.ClientConfigs()
+
+	r.sendPlayer(true, RoomMessage{
+		msgType: RoomGameStarted,
+		config:  cfg1,
+		token:   r.seatP1.token,
+	})
+	r.sendPlayer(false, RoomMessage{
+		msgType: RoomGameStarted,
+		config:  cfg2,
+		token:   r.seatP2.token,
+	})
+	r.restartSpectators()
+	r.startTurnTimer()
+	r.setState(r.running)
+}
+
+func (r *Room) resolveTurn() {
+	p1, p2 := r.Actions()
+	r.ClearActions()
+	fmt.Println("queued", p1, p2)
+
+	results1, results2 := r.gamestate.ResolveActions(p1, p2)
+	if r.replay != nil {
+		if err := r.replay.record(p1, p2, results1, results2); err != nil {
+			fmt.Println("room: replay:", err)
+		}
+	}
+
+	r.sendTurnResults(true, results1)
+	r.sendTurnResults(false, results2)
+	r.recordSpectatorResults(results1, results2)
+
+	gameResultP1, gameResultP2, ok := r.gamestate.Result()
+	if !ok {
+		r.startTurnTimer()
+		return
+	}
+
+	r.finishGame(gameResultP1, gameResultP2)
+}
+
+func (r *Room) finishGame(resultP1, resultP2 GameResult) {
+	r.stopTurnTimer()
+	r.seatP1.stopReconnect()
+	r.seatP2.stopReconnect()
+	r.sendPlayer(true, RoomMessage{msgType: RoomGameFinished, gameResult: resultP1})
+	r.sendPlayer(false, RoomMessage{msgType: RoomGameFinished, gameResult: resultP2})
+	r.finishSpectators(resultP1, resultP2)
+	r.saveReplay(resultP1)
+
+	r.series.record(resultP1)
+	r.sendSeries(true, r.series.status(true))
+	r.sendSeries(false, r.series.status(false))
+
+	r.setState(r.postGame)
+
+	if r.draining {
+		r.shutdownRoom()
+		return
+	}
+	// a player who is gone cant accept a rematch
+	if r.player1chans.read == nil {
+		r.abandon(true)
+	} else if r.player2chans.read == nil {
+		r.abandon(false)
+	}
+}
+
+func (r *Room) saveReplay(resultP1 GameResult) {
+	if r.replay == nil {
+		return
+	}
+	r.replay.ResultP1 = resultP1
+	path, err := r.replay.Save(r.settings.replayDir)
+	if err != nil {
+		fmt.Println("room: replay:", err)
+	} else {
+		fmt.Println("room: replay saved:", path)
+	}
+	r.replay = nil
+}
+
+func (r *Room) forfeit(isP1 bool) {
+	if isP1 {
+		r.finishGame(Lose, Win)
+	} else {
+		r.finishGame(Win, Lose)
+	}
+}
+
+// leave ends the game and the series for a player walking out of the room.
+func (r *Room) leave(isP1 bool) {
+	r.forfeit(isP1)
+	if r.state == r.postGame {
+		r.abandon(isP1)
+	}
+}
+
+func (r *Room) abandon(isP1 bool) {
+	r.forfeitSeries(isP1)
+	r.closeRoom()
+}
+
+func (r *Room) closeRoom() {
+	r.stopTurnTimer()
+	r.closePlayer(true)
+	r.closePlayer(false)
+	r.closeSpectators()
+	r.requestClose()
+	r.setState(r.closing)
+}
+
+// shutdownRoom closes the room for a server shutdown, a running game is
+// checkpointed instead of being decided.
+func (r *Room) shutdownRoom() {
+	detail := "server is shutting down"
+	if r.state == r.running {
+		r.saveCheckpoint()
+		detail = "server is shutting down, the game is saved"
+	}
+	r.abort(ErrShuttingDown, detail)
+}
+
+// abort closes the room telling both players why, a running game ends without
+// a result.
+func (r *Room) abort(code ErrorCode, detail string) {
+	r.rejectPlayer(true, code, detail)
+	r.rejectPlayer(false, code, detail)
+	r.closeRoom()
+}
+
+func (r *Room) vacateSeat(isP1 bool) {
+	chans, seat := r.playerChans(isP1)
+	close(chans.read)
+	chans.read = nil
+	chans.send = nil
+	seat.reconnect = time.NewTimer(r.settings.reconnectGrace)
+}
+
+// reclaimSeat hands a held seat to a new connection, replaying the whole game
+// so the client can rebuild its state.
+func (r *Room) reclaimSeat(isP1 bool, req RoomRequest) {
+	chans, seat := r.playerChans(isP1)
+	seat.stopReconnect()
+	if chans.read != nil {
+		close(chans.read)
+	}
+	*chans = req.chans
+
+	cfg1, cfg2 := r.gamestate.ClientConfigs()
+	cfg := cfg1
+	if !isP1 {
+		cfg = cfg2
+	}
+	r.sendPlayer(isP1, RoomMessage{msgType: RoomJoined, code: r.code})
+	r.sendPlayer(isP1, RoomMessage{
+		msgType: RoomGameStarted,
+		config:  cfg,
+		token:   seat.token,
+	})
+	for _, results := range seat.results {
+		r.sendPlayer(isP1, RoomMessage{
+			msgType:     RoomTurnResult,
+			turnResults: results,
+		})
+	}
+	r.sendTurnDeadline(isP1)
+}
+
+func newReconnectToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func (r *Room) QueueActions(actions []TankAction, p1 bool) bool {
 	if p1 {
 		r.queuedP1.queued = true
@@ -101,9 +499,51 @@ func (r *Room) Actions() ([]TankAction, []TankAction) {
 	return r.queuedP1.actions, r.queuedP2.actions
 }
 
+func (r *Room) turnExpired() <-chan time.Time {
+	if r.turnTimer == nil {
+		return nil
+	}
+	return r.turnTimer.C
+}
+
+func (r *Room) startTurnTimer() {
+	r.stopTurnTimer()
+	if r.settings.turnTimeout <= 0 {
+		return
+	}
+	r.turnTimer = time.NewTimer(r.settings.turnTimeout)
+	r.turnDeadline = time.Now().Add(r.settings.turnTimeout)
+	r.sendTurnDeadline(true)
+	r.sendTurnDeadline(false)
+}
+
+func (r *Room) stopTurnTimer() {
+	if r.turnTimer == nil {
+		return
+	}
+	r.turnTimer.Stop()
+	r.turnTimer = nil
+}
+
+func (r *Room) sendTurnDeadline(isP1 bool) {
+	if r.turnTimer == nil {
+		return
+	}
+	r.sendPlayer(isP1, RoomMessage{
+		msgType:  RoomTurnDeadline,
+		turn:     r.gamestate.Turn(),
+		deadline: r.turnDeadline,
+	})
+}
+
 type RoomState interface {
 	handleJoinRequest(req RoomRequest, ok bool) bool
 	handlePlayerMessage(msg PlayerMessage, isP1 bool)
+	handleSeatExpired(isP1 bool)
+	handleTurnTimeout()
+	handleDrain()
+	handleStop()
+	handleAdminClose(reason string)
 }
 
 type RoomStateWaitingForP1 struct {
@@ -112,17 +552,43 @@ type RoomStateWaitingForP1 struct {
 
 func (s RoomStateWaitingForP1) handleJoinRequest(req RoomRequest, ok bool) bool {
 	if !ok {
-		panic("shouldnt require closing in waiting state")
+		s.r.fail(newInvariantError(s, "closed by the hub"))
+		return true
+	}
+	if req.token != "" || req.spectate {
+		rejectRequest(req.chans, ErrRoomNotFound, "room doesnt exist")
+		return false
 	}
 
+	s.r.options = req.options.withDefaults(s.r.settings.defaultOptions).normalized()
 	s.r.player1chans = req.chans
-	s.r.player1chans.read <- RoomMessage{msgType: RoomJoined}
+	s.r.player1chans.read <- RoomMessage{msgType: RoomJoined, code: s.r.code}
 	s.r.setState(s.r.waitingForP2)
 	return false
 }
 
 func (s RoomStateWaitingForP1) handlePlayerMessage(msg PlayerMessage, isP1 bool) {
-	panic("shouldnt receive player message while in waiting state")
+	s.r.fail(newInvariantError(s, "player message"))
+}
+
+func (s RoomStateWaitingForP1) handleSeatExpired(isP1 bool) {
+	s.r.fail(newInvariantError(s, "seat expired"))
+}
+
+func (s RoomStateWaitingForP1) handleTurnTimeout() {
+	s.r.fail(newInvariantError(s, "turn timeout"))
+}
+
+func (s RoomStateWaitingForP1) handleDrain() {
+	s.r.shutdownRoom()
+}
+
+func (s RoomStateWaitingForP1) handleStop() {
+	s.r.shutdownRoom()
+}
+
+func (s RoomStateWaitingForP1) handleAdminClose(reason string) {
+	s.r.abort(ErrRoomClosed, reason)
 }
 
 type RoomStateWaitingForP2 struct {
@@ -131,40 +597,54 @@ type RoomStateWaitingForP2 struct {
 
 func (s RoomStateWaitingForP2) handleJoinRequest(req RoomRequest, ok bool) bool {
 	if !ok {
-		panic("shouldnt require closing in waiting state")
+		s.r.fail(newInvariantError(s, "closed by the hub"))
+		return true
+	}
+	if req.token != "" || req.spectate {
+		rejectRequest(req.chans, ErrGameNotRunning, "game hasnt started yet")
+		return false
 	}
 
 	s.r.player2chans = req.chans
-	s.r.player2chans.read <- RoomMessage{msgType: RoomJoined}
+	s.r.player2chans.read <- RoomMessage{msgType: RoomJoined, code: s.r.code}
 
-	s.r.gamestate = NewGameState(NewBasicConfig(false, true))
-	cfg1, cfg2 := s.r.gamestate.ClientConfigs()
-
-	s.r.player1chans.read <- RoomMessage{msgType: RoomGameStarted, config: cfg1}
-	s.r.player2chans.read <- RoomMessage{msgType: RoomGameStarted, config: cfg2}
-
-	s.r.setState(s.r.running)
+	s.r.series = newSeries(*s.r.options.BestOf)
+	s.r.startGame()
 	return false
 }
 
 func (s RoomStateWaitingForP2) handlePlayerMessage(msg PlayerMessage, isP1 bool) {
 	if !isP1 {
-		panic("shouldnt receive message from p2 before him joining")
+		s.r.fail(newInvariantError(s, "message from player 2"))
+		return
 	}
 	switch msg.msgType {
-	case PlayerQuitRoom:
-		close(s.r.player1chans.read)
-		s.r.player1chans.send = nil
+	case PlayerQuitRoom, PlayerDisconnected:
+		s.r.closeRoom()
+	case PlayerSendTurn, PlayerRematch:
+		s.r.rejectPlayer(isP1, ErrWaitingForOpponent, "no opponent has joined yet")
+	}
+}
+
+func (s RoomStateWaitingForP2) handleSeatExpired(isP1 bool) {
+	s.r.fail(newInvariantError(s, "seat expired"))
+}
 
-		ch := s.r.close
-		go func(ch chan string) {
-			ch <- s.r.code
-		}(ch)
+func (s RoomStateWaitingForP2) handleTurnTimeout() {
+	s.r.fail(newInvariantError(s, "turn timeout"))
+}
 
-		s.r.setState(s.r.closing)
-	case PlayerSendTurn:
-		fmt.Println("illegal")
-	}
+// a game that hasnt started wont be allowed to
+func (s RoomStateWaitingForP2) handleDrain() {
+	s.r.shutdownRoom()
+}
+
+func (s RoomStateWaitingForP2) handleStop() {
+	s.r.shutdownRoom()
+}
+
+func (s RoomStateWaitingForP2) handleAdminClose(reason string) {
+	s.r.abort(ErrRoomClosed, reason)
 }
 
 type RoomStateRunning struct {
@@ -173,81 +653,156 @@ type RoomStateRunning struct {
 
 func (s RoomStateRunning) handleJoinRequest(req RoomRequest, ok bool) bool {
 	if !ok {
-		panic("shouldnt require closing in waiting state")
+		s.r.fail(newInvariantError(s, "closed by the hub"))
+		return true
+	}
+	if req.spectate {
+		if max := s.r.settings.maxSpectators; max > 0 && len(s.r.spectators) >= max {
+			rejectRequest(req.chans, ErrRoomFull, "room has too many spectators")
+			return false
+		}
+		s.r.addSpectator(req.chans)
+		return false
+	}
+	switch req.token {
+	case "":
+		rejectRequest(req.chans, ErrRoomFull, "room already has two players")
+	case s.r.seatP1.token:
+		s.r.reclaimSeat(true, req)
+	case s.r.seatP2.token:
+		s.r.reclaimSeat(false, req)
+	default:
+		rejectRequest(req.chans, ErrInvalidToken, "reconnect token doesnt match any seat")
 	}
-	close(req.chans.read)
 	return false
 }
 
 func (s RoomStateRunning) handlePlayerMessage(msg PlayerMessage, isP1 bool) {
 	switch msg.msgType {
 	case PlayerQuitRoom:
-		res1, res2 := Win, Win
-		if isP1 {
-			res1 = Lose
-		} else {
-			res2 = Lose
-		}
-		s.r.player1chans.read <- RoomMessage{msgType: RoomGameFinished, gameResult: res1}
-		s.r.player2chans.read <- RoomMessage{msgType: RoomGameFinished, gameResult: res2}
-		close(s.r.player1chans.read)
-		close(s.r.player2chans.read)
-		s.r.player1chans.send = nil
-		s.r.player2chans.send = nil
+		s.r.leave(isP1)
 
-		ch := s.r.close
-		go func(ch chan string) {
-			ch <- s.r.code
-		}(ch)
+	case PlayerDisconnected:
+		if s.r.settings.reconnectGrace <= 0 {
+			s.r.leave(isP1)
+			return
+		}
+		s.r.vacateSeat(isP1)
 
-		s.r.setState(s.r.closing)
+	case PlayerRematch:
+		s.r.rejectPlayer(isP1, ErrGameRunning, "cant rematch before the game is finished")
 
 	case PlayerSendTurn:
+		_, seat := s.r.playerChans(isP1)
+		seat.timeouts = 0
 		if s.r.QueueActions(msg.tankActions, isP1) {
-			p1, p2 := s.r.Actions()
-			s.r.ClearActions()
-			fmt.Println("queued", p1, p2)
+			s.r.resolveTurn()
+		}
+	}
+}
 
-			results1, results2 := s.r.gamestate.ResolveActions(p1, p2)
+func (s RoomStateRunning) handleSeatExpired(isP1 bool) {
+	// with both seats empty nobody is left to win, the game is dropped
+	// without a result
+	if _, other := s.r.playerChans(!isP1); other.reconnect != nil {
+		s.r.closeRoom()
+		return
+	}
+	s.r.leave(isP1)
+}
 
-			s.r.player1chans.read <- RoomMessage{
-				msgType:     RoomTurnResult,
-				turnResults: results1,
-			}
-			s.r.player2chans.read <- RoomMessage{
-				msgType:     RoomTurnResult,
-				turnResults: results2,
-			}
+// handleTurnTimeout resolves the turn with no actions for whoever didnt
+// submit, unless that pushes them over the timeout limit.
+func (s RoomStateRunning) handleTurnTimeout() {
+	if !s.r.queuedP1.queued {
+		s.r.seatP1.timeouts++
+	}
+	if !s.r.queuedP2.queued {
+		s.r.seatP2.timeouts++
+	}
 
-			gameResultP1, gameResultP2, ok := s.r.gamestate.Result()
-			if !ok {
-				return
-			}
+	limit := s.r.settings.maxTimeouts
+	forfeitP1 := limit > 0 && s.r.seatP1.timeouts >= limit
+	forfeitP2 := limit > 0 && s.r.seatP2.timeouts >= limit
+	switch {
+	case forfeitP1 && forfeitP2:
+		s.r.finishGame(Draw, Draw)
+	case forfeitP1:
+		s.r.forfeit(true)
+	case forfeitP2:
+		s.r.forfeit(false)
+	default:
+		s.r.resolveTurn()
+	}
+}
 
-			s.r.player1chans.read <- RoomMessage{
-				msgType:    RoomGameFinished,
-				gameResult: gameResultP1,
-			}
-			s.r.player2chans.read <- RoomMessage{
-				msgType:    RoomGameFinished,
-				gameResult: gameResultP2,
-			}
+// running games get until the stop to finish
+func (s RoomStateRunning) handleDrain() {
+}
 
-			close(s.r.player1chans.read)
-			close(s.r.player2chans.read)
-			s.r.player1chans.send = nil
-			s.r.player2chans.send = nil
+func (s RoomStateRunning) handleStop() {
+	s.r.shutdownRoom()
+}
+
+func (s RoomStateRunning) handleAdminClose(reason string) {
+	s.r.abort(ErrRoomClosed, reason)
+}
+
+type RoomStatePostGame struct {
+	r *Room
+}
 
-			ch := s.r.close
-			go func(ch chan string) {
-				ch <- s.r.code
-			}(ch)
+func (s RoomStatePostGame) handleJoinRequest(req RoomRequest, ok bool) bool {
+	if !ok {
+		s.r.fail(newInvariantError(s, "closed by the hub"))
+		return true
+	}
+	if req.spectate {
+		rejectRequest(req.chans, ErrGameNotRunning, "game is finished")
+		return false
+	}
+	rejectRequest(req.chans, ErrRoomFull, "room already has two players")
+	return false
+}
 
-			s.r.setState(s.r.closing)
+func (s RoomStatePostGame) handlePlayerMessage(msg PlayerMessage, isP1 bool) {
+	switch msg.msgType {
+	case PlayerQuitRoom, PlayerDisconnected:
+		s.r.abandon(isP1)
+	case PlayerRematch:
+		_, seat := s.r.playerChans(isP1)
+		seat.rematch = true
+		if !s.r.seatP1.rematch || !s.r.seatP2.rematch {
+			return
+		}
+		if s.r.series.finished() {
+			s.r.series = newSeries(*s.r.options.BestOf)
 		}
+		s.r.startGame()
+	case PlayerSendTurn:
+		s.r.rejectPlayer(isP1, ErrGameNotRunning, "game is finished")
 	}
 }
 
+func (s RoomStatePostGame) handleSeatExpired(isP1 bool) {
+}
+
+func (s RoomStatePostGame) handleTurnTimeout() {
+}
+
+// no rematches once the server is shutting down
+func (s RoomStatePostGame) handleDrain() {
+	s.r.shutdownRoom()
+}
+
+func (s RoomStatePostGame) handleStop() {
+	s.r.shutdownRoom()
+}
+
+func (s RoomStatePostGame) handleAdminClose(reason string) {
+	s.r.abort(ErrRoomClosed, reason)
+}
+
 type RoomStateClosing struct {
 	r *Room
 }
@@ -257,9 +812,24 @@ func (s RoomStateClosing) handleJoinRequest(req RoomRequest, ok bool) bool {
 		return true
 
 	}
-	close(req.chans.read)
+	rejectRequest(req.chans, ErrRoomNotFound, "room is closing")
 	return false
 }
 
 func (s RoomStateClosing) handlePlayerMessage(msg PlayerMessage, isP1 bool) {
 }
+
+func (s RoomStateClosing) handleSeatExpired(isP1 bool) {
+}
+
+func (s RoomStateClosing) handleTurnTimeout() {
+}
+
+func (s RoomStateClosing) handleDrain() {
+}
+
+func (s RoomStateClosing) handleStop() {
+}
+
+func (s RoomStateClosing) handleAdminClose(reason string) {
+}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestSidesAlternate(t *testing.T) {
+	gc := NewBasicConfig(false, true)
+	for game := range 4 {
+		swap, p1First := sides(game)
+		gs := NewGameState(gc.withSides(swap, p1First))
+
+		// the first game is played like a single game before series existed
+		wantSwap := game%2 == 1
+		if _, ok := gs.tanksP1[gc.tanksP2[0].Id]; ok != wantSwap {
+			t.Errorf("game %d: seat 1 plays the second spawns: %v, want %v", game+1, ok, wantSwap)
+		}
+		if gs.turnP1 != wantSwap {
+			t.Errorf("game %d: seat 1 moves first: %v, want %v", game+1, gs.turnP1, wantSwap)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+type Series struct {
+	bestOf int
+	// games finished so far
+	game   int
+	winsP1 int
+	winsP2 int
+	draws  int
+}
+
+func newSeries(bestOf int) Series {
+	return Series{bestOf: max(bestOf, 1)}
+}
+
+func (s Series) finished() bool {
+	needed := s.bestOf/2 + 1
+	return s.winsP1 >= needed || s.winsP2 >= needed || s.game >= s.bestOf
+}
+
+func (s *Series) record(resultP1 GameResult) {
+	s.game++
+	switch resultP1 {
+	case Win:
+		s.winsP1++
+	case Lose:
+		s.winsP2++
+	case Draw:
+		s.draws++
+	}
+}
+
+func (s Series) result() (GameResult, GameResult) {
+	switch {
+	case s.winsP1 > s.winsP2:
+		return Win, Lose
+	case s.winsP1 < s.winsP2:
+		return Lose, Win
+	}
+	return Draw, Draw
+}
+
+// status reports the series from one players point of view, the result is
+// only meaningful once the series finished.
+func (s Series) status(isP1 bool) SeriesStatus {
+	resultP1, resultP2 := s.result()
+	status := SeriesStatus{
+		Game:     s.game,
+		BestOf:   s.bestOf,
+		Wins:     s.winsP1,
+		Losses:   s.winsP2,
+		Draws:    s.draws,
+		Finished: s.finished(),
+		Result:   resultP1,
+	}
+	if !isP1 {
+		status.Wins, status.Losses = status.Losses, status.Wins
+		status.Result = resultP2
+	}
+	return status
+}
+
+func (r *Room) sendSeries(isP1 bool, status SeriesStatus) {
+	r.sendPlayer(isP1, RoomMessage{msgType: RoomSeriesUpdate, series: status})
+}
+
+// forfeitSeries ends an unfinished series in favor of whoever didnt leave.
+func (r *Room) forfeitSeries(isP1 bool) {
+	if r.series.finished() {
+		return
+	}
+	status := r.series.status(!isP1)
+	status.Finished = true
+	status.Result = Win
+	r.sendSeries(!isP1, status)
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const envPrefix = "TANKOPS_"
+
+// Duration reads and writes JSON as a duration string like "30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// listFlag is a comma separated flag, setting it replaces the whole list.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// ServerConfig holds every setting of the server. Defaults are overridden by
+// the config file, then environment variables, then flags.
+type ServerConfig struct {
+	Listen string `json:"listen"`
+	// serves the web client from disk instead of the embedded copy, meant for
+	// development
+	StaticDir    string   `json:"staticDir"`
+	StaticMaxAge Duration `json:"staticMaxAge"`
+	// both or neither must be set, neither serves plain http
+	TLSCert string `json:"tlsCert"`
+	TLSKey  string `json:"tlsKey"`
+	// origins allowed to open a websocket besides the server's own, "*"
+	// allows any
+	AllowedOrigins []string `json:"allowedOrigins"`
+	// serves the admin API and pprof, empty disables it
+	AdminListen string `json:"adminListen"`
+	// bearer token every admin request must carry
+	AdminToken        string   `json:"adminToken"`
+	ReadBufferSize    int      `json:"readBufferSize"`
+	WriteBufferSize   int      `json:"writeBufferSize"`
+	ReadHeaderTimeout Duration `json:"readHeaderTimeout"`
+	DrainTimeout      Duration `json:"drainTimeout"`
+
+	// zero means no limit
+	MaxRooms      int `json:"maxRooms"`
+	MaxSpectators int `json:"maxSpectators"`
+
+	MapsDir    string `json:"mapsDir"`
+	DefaultMap string `json:"defaultMap"`
+	ReplayDir  string `json:"replayDir"`
+	DumpDir    string `json:"dumpDir"`
+	// games running at shutdown are saved here
+	CheckpointDir string `json:"checkpointDir"`
+
+	ReconnectGrace Duration `json:"reconnectGrace"`
+	TurnTimeout    Duration `json:"turnTimeout"`
+	MaxTimeouts    int      `json:"maxTimeouts"`
+
+	PingInterval   Duration `json:"pingInterval"`
+	PongWait       Duration `json:"pongWait"`
+	WriteWait      Duration `json:"writeWait"`
+	MaxMessageSize int64    `json:"maxMessageSize"`
+	SendQueue      int      `json:"sendQueue"`
+
+	// used for whatever the room creator leaves out
+	BestOf         int           `json:"bestOf"`
+	SpectatorView  SpectatorView `json:"spectatorView"`
+	SpectatorDelay int           `json:"spectatorDelay"`
+}
+
+func NewDefaultServerConfig() ServerConfig {
+	room := NewDefaultRoomSettings()
+	player := NewDefaultPlayerSettings()
+	hub := NewDefaultHubSettings()
+	return ServerConfig{
+		Listen:            "localhost:8000",
+		StaticMaxAge:      Duration(time.Hour),
+		ReadBufferSize:    hub.readBufferSize,
+		WriteBufferSize:   hub.writeBufferSize,
+		ReadHeaderTimeout: Duration(10 * time.Second),
+		DrainTimeout:      Duration(60 * time.Second),
+		MapsDir:           "maps",
+		DefaultMap:        hub.defaultMap,
+		ReconnectGrace:    Duration(room.reconnectGrace),
+		TurnTimeout:       Duration(room.turnTimeout),
+		MaxTimeouts:       room.maxTimeouts,
+		PingInterval:      Duration(player.pingInterval),
+		PongWait:          Duration(player.pongWait),
+		WriteWait:         Duration(player.writeWait),
+		MaxMessageSize:    player.maxMessageSize,
+		SendQueue:         player.sendQueue,
+		BestOf:            1,
+		SpectatorView:     SpectatorOmniscient,
+	}
+}
+
+func (c *ServerConfig) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Listen, "listen", c.Listen, "address the game server listens on")
+	fs.StringVar(
+		&c.StaticDir,
+		"static-dir",
+		c.StaticDir,
+		"directory the web client is served from instead of the embedded one, for development",
+	)
+	fs.DurationVar(
+		(*time.Duration)(&c.StaticMaxAge),
+		"static-max-age",
+		time.Duration(c.StaticMaxAge),
+		"how long browsers may cache embedded assets other than pages",
+	)
+	fs.StringVar(&c.TLSCert, "tls-cert", c.TLSCert, "TLS certificate file, needs -tls-key")
+	fs.StringVar(&c.TLSKey, "tls-key", c.TLSKey, "TLS key file, needs -tls-cert")
+	fs.Var(
+		(*listFlag)(&c.AllowedOrigins),
+		"allowed-origins",
+		"comma separated origins allowed to connect besides the server's own, * allows any",
+	)
+	fs.StringVar(
+		&c.AdminListen,
+		"admin-listen",
+		c.AdminListen,
+		"address the admin API and pprof are served on, empty disables them",
+	)
+	fs.StringVar(&c.AdminToken, "admin-token", c.AdminToken, "bearer token admin requests must carry")
+	fs.IntVar(&c.ReadBufferSize, "read-buffer-size", c.ReadBufferSize, "websocket read buffer in bytes")
+	fs.IntVar(&c.WriteBufferSize, "write-buffer-size", c.WriteBufferSize, "websocket write buffer in bytes")
+	fs.DurationVar(
+		(*time.Duration)(&c.ReadHeaderTimeout),
+		"read-header-timeout",
+		time.Duration(c.ReadHeaderTimeout),
+		"time allowed to read request headers",
+	)
+	fs.DurationVar(
+		(*time.Duration)(&c.DrainTimeout),
+		"drain-timeout",
+		time.Duration(c.DrainTimeout),
+		"time running games get to finish on shutdown before they are checkpointed",
+	)
+	fs.IntVar(&c.MaxRooms, "max-rooms", c.MaxRooms, "rooms open at once, 0 is unlimited")
+	fs.IntVar(&c.MaxSpectators, "max-spectators", c.MaxSpectators, "spectators per room, 0 is unlimited")
+	fs.StringVar(&c.MapsDir, "maps", c.MapsDir, "directory with map files")
+	fs.StringVar(&c.DefaultMap, "default-map", c.DefaultMap, "map used when a room doesnt pick one")
+	fs.StringVar(&c.ReplayDir, "replays", c.ReplayDir, "directory finished games are saved to, empty disables replays")
+	fs.StringVar(&c.DumpDir, "dumps", c.DumpDir, "directory dumps of failed rooms are saved to, empty prints them")
+	fs.StringVar(
+		&c.CheckpointDir,
+		"checkpoints",
+		c.CheckpointDir,
+		"directory games running at shutdown are saved to, empty prints them",
+	)
+	fs.DurationVar(
+		(*time.Duration)(&c.ReconnectGrace),
+		"reconnect-grace",
+		time.Duration(c.ReconnectGrace),
+		"how long a disconnected player's seat is held, 0 forfeits immediately",
+	)
+	fs.DurationVar(
+		(*time.Duration)(&c.TurnTimeout),
+		"turn-timeout",
+		time.Duration(c.TurnTimeout),
+		"time players have to submit a turn, 0 waits forever",
+	)
+	fs.IntVar(
+		&c.MaxTimeouts,
+		"max-timeouts",
+		c.MaxTimeouts,
+		"consecutive turn timeouts that forfeit the game, 0 never forfeits",
+	)
+	fs.DurationVar(
+		(*time.Duration)(&c.PingInterval),
+		"ping-interval",
+		time.Duration(c.PingInterval),
+		"how often connections are pinged, 0 disables pings",
+	)
+	fs.DurationVar(
+		(*time.Duration)(&c.PongWait),
+		"pong-wait",
+		time.Duration(c.PongWait),
+		"silence after which a connection counts as dropped, 0 never times out",
+	)
+	fs.DurationVar(
+		(*time.Duration)(&c.WriteWait),
+		"write-wait",
+		time.Duration(c.WriteWait),
+		"time allowed for a single write, 0 never times out",
+	)
+	fs.Int64Var(&c.MaxMessageSize, "max-message-size", c.MaxMessageSize, "largest client message in bytes")
+	fs.IntVar(
+		&c.SendQueue,
+		"send-queue",
+		c.SendQueue,
+		"messages queued per client before it is disconnected as too slow",
+	)
+	fs.IntVar(&c.BestOf, "best-of", c.BestOf, "games in a series unless the room picks otherwise")
+	fs.IntVar(
+		(*int)(&c.SpectatorView),
+		"spectator-view",
+		int(c.SpectatorView),
+		"what spectators see unless the room picks otherwise, 1 everything, 2 or 3 a player's view",
+	)
+	fs.IntVar(
+		&c.SpectatorDelay,
+		"spectator-delay",
+		c.SpectatorDelay,
+		"turns spectators lag behind unless the room picks otherwise",
+	)
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// LoadServerConfig builds the config from the defaults, the file named by
+// -config, the environment and args, in that order.
+func LoadServerConfig(args []string) (ServerConfig, error) {
+	// the first pass only finds the config file, flags are applied again once
+	// the file is loaded so they take precedence over it
+	path := ""
+	first := flag.NewFlagSet("tank-ops", flag.ExitOnError)
+	discard := NewDefaultServerConfig()
+	discard.bindFlags(first)
+	first.StringVar(&path, "config", os.Getenv(envName("config")), "JSON config file")
+	first.Usage = func() {
+		fmt.Fprintln(first.Output(), "Usage of tank-ops:")
+		first.PrintDefaults()
+		fmt.Fprintf(first.Output(), "Every flag can also be set with %s<FLAG_NAME>.\n", envPrefix)
+	}
+	first.Parse(args)
+
+	c := NewDefaultServerConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return c, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			return c, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	fs := flag.NewFlagSet("tank-ops", flag.ContinueOnError)
+	c.bindFlags(fs)
+	fs.String("config", "", "")
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || envErr != nil || f.Name == "config" {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			envErr = fmt.Errorf("%s: %w", envName(f.Name), err)
+		}
+	})
+	if envErr != nil {
+		return c, envErr
+	}
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	return c, c.validate()
+}
+
+func (c ServerConfig) validate() error {
+	if c.Listen == "" {
+		return errors.New("listen address cant be empty")
+	}
+	if c.AdminListen != "" && c.AdminListen == c.Listen {
+		return errors.New("admin listener needs its own address")
+	}
+	if c.AdminListen != "" && c.AdminToken == "" {
+		return errors.New("admin listener needs a token")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("tls needs both a certificate and a key")
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("allowed origin %q must look like scheme://host", origin)
+		}
+	}
+	if c.ReadBufferSize <= 0 || c.WriteBufferSize <= 0 {
+		return errors.New("buffer sizes must be positive")
+	}
+	if c.ReadHeaderTimeout < 0 || c.DrainTimeout < 0 || c.StaticMaxAge < 0 {
+		return errors.New("durations cant be negative")
+	}
+	if c.MaxRooms < 0 || c.MaxSpectators < 0 {
+		return errors.New("limits cant be negative")
+	}
+	if c.ReconnectGrace < 0 || c.TurnTimeout < 0 || c.MaxTimeouts < 0 {
+		return errors.New("room timeouts cant be negative")
+	}
+	if c.BestOf < 1 {
+		return errors.New("best of must be positive")
+	}
+	switch c.SpectatorView {
+	case SpectatorOmniscient, SpectatorPlayer1, SpectatorPlayer2:
+	default:
+		return fmt.Errorf("unknown spectator view %d", c.SpectatorView)
+	}
+	if c.SpectatorDelay < 0 {
+		return errors.New("spectator delay cant be negative")
+	}
+	if err := c.playerSettings().validate(); err != nil {
+		return fmt.Errorf("player settings: %w", err)
+	}
+	return nil
+}
+
+// redacted hides secrets so the config can be printed.
+func (c ServerConfig) redacted() ServerConfig {
+	if c.AdminToken != "" {
+		c.AdminToken = "redacted"
+	}
+	return c
+}
+
+func (c ServerConfig) hubSettings() HubSettings {
+	return HubSettings{
+		defaultMap:      c.DefaultMap,
+		maxRooms:        c.MaxRooms,
+		readBufferSize:  c.ReadBufferSize,
+		writeBufferSize: c.WriteBufferSize,
+		allowedOrigins:  c.AllowedOrigins,
+	}
+}
+
+func (c ServerConfig) roomSettings() RoomSettings {
+	return RoomSettings{
+		reconnectGrace: time.Duration(c.ReconnectGrace),
+		turnTimeout:    time.Duration(c.TurnTimeout),
+		maxTimeouts:    c.MaxTimeouts,
+		maxSpectators:  c.MaxSpectators,
+		replayDir:      c.ReplayDir,
+		dumpDir:        c.DumpDir,
+		checkpointDir:  c.CheckpointDir,
+		defaultOptions: RoomOptions{
+			SpectatorView:  &c.SpectatorView,
+			SpectatorDelay: &c.SpectatorDelay,
+			BestOf:         &c.BestOf,
+		},
+	}
+}
+
+func (c ServerConfig) playerSettings() PlayerSettings {
+	return PlayerSettings{
+		pingInterval:   time.Duration(c.PingInterval),
+		pongWait:       time.Duration(c.PongWait),
+		writeWait:      time.Duration(c.WriteWait),
+		maxMessageSize: c.MaxMessageSize,
+		sendQueue:      c.SendQueue,
+	}
+}
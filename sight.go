@@ -0,0 +1,105 @@
+package main
+
+import "fmt"
+
+// VisibilityModel decides which hexes a tank sees, picked per map.
+type VisibilityModel string
+
+const (
+	// every hex within visibilityRange is seen
+	VisibilityRange VisibilityModel = "range"
+	// like range, but sight is stopped by blockers between the two hexes
+	VisibilityLineOfSight VisibilityModel = "line_of_sight"
+)
+
+func (m VisibilityModel) validate() error {
+	switch m {
+	case VisibilityRange, VisibilityLineOfSight:
+		return nil
+	}
+	return fmt.Errorf("unknown visibility model %q", m)
+}
+
+// sees tells whether a tank on from sees to, blocks reports the hexes that
+// stop sight. The client implements the same rules in vector.ts.
+func (m VisibilityModel) sees(from, to Vector, visibilityRange int, blocks func(Vector) bool) bool {
+	if from.distance(to) > visibilityRange {
+		return false
+	}
+	if m != VisibilityLineOfSight {
+		return true
+	}
+	// a line running exactly along the edge between two hexes is clear when
+	// either side of it is, this also keeps sight symmetric
+	return clearLine(hexLine(from, to, 1), blocks) || clearLine(hexLine(from, to, -1), blocks)
+}
+
+// clearLine ignores both ends, a tank sees the blocker it looks at.
+func clearLine(line []Vector, blocks func(Vector) bool) bool {
+	for i := 1; i < len(line)-1; i++ {
+		if blocks(line[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// lineScale keeps the nudge far below any fraction a line step can have.
+const lineScale = 1 << 20
+
+// hexLine returns the hexes on the straight line from a to b, both included.
+// The line is nudged to one side, so no point falls exactly between two
+// hexes, and integer math keeps it identical on every platform.
+func hexLine(a, b Vector, side int) []Vector {
+	n := a.distance(b)
+	if n == 0 {
+		return []Vector{a}
+	}
+	den := n * lineScale
+	line := make([]Vector, 0, n+1)
+	for i := 0; i <= n; i++ {
+		x := (a.X*(n-i)+b.X*i)*lineScale + side
+		y := (a.Y*(n-i)+b.Y*i)*lineScale + 2*side
+		line = append(line, roundHex(x, y, den))
+	}
+	return line
+}
+
+// roundHex rounds the fractional hex (x/den, y/den) to the hex containing it.
+func roundHex(x, y, den int) Vector {
+	z := -x - y
+	rx, ry, rz := divRound(x, den), divRound(y, den), divRound(z, den)
+	dx, dy, dz := abs(x-rx*den), abs(y-ry*den), abs(z-rz*den)
+	if dx > dy && dx > dz {
+		rx = -ry - rz
+	} else if dy > dz {
+		ry = -rx - rz
+	}
+	return Vector{rx, ry}
+}
+
+func divRound(v, den int) int {
+	return floorDiv(2*v+den, 2*den)
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// canSee applies the map's visibility model to the current board, concealing
+// terrain on to shortens the range of the tank.
+func (gs *GameState) canSee(t *Tank, to Vector) bool {
+	visibilityRange := t.class.VisibilityRange - gs.terrainAt(to).Concealment
+	return gs.cfg.visibility.sees(t.p, to, visibilityRange, gs.blocksSight)
+}
+
+func (gs *GameState) blocksSight(p Vector) bool {
+	if _, ok := gs.hexes[p]; !ok {
+		return false
+	}
+	return gs.collidesWithSite(p) || gs.terrainAt(p).BlocksSight
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+const SnapshotVersion = 1
+
+type TankSnapshot struct {
+	Id        int    `json:"id"`
+	P         Vector `json:"p"`
+	Visible   bool   `json:"visible"`
+	Destroyed bool   `json:"destroyed"`
+	Seen      bool   `json:"seen"`
+	HP        int    `json:"hp"`
+}
+
+type ShellSnapshot struct {
+	Id     int    `json:"id"`
+	Target Vector `json:"target"`
+	Splash int    `json:"splash"`
+}
+
+type HexSnapshot struct {
+	P           Vector `json:"p"`
+	Traversable bool   `json:"traversable"`
+}
+
+// GameStateSnapshot is the authoritative state between two turns, the map
+// keeps the starting layout while hexes only hold what is left of it.
+type GameStateSnapshot struct {
+	Version int            `json:"version"`
+	Map     MapConfig      `json:"map"`
+	P1First bool           `json:"p1First"`
+	Hexes   []HexSnapshot  `json:"hexes"`
+	TanksP1 []TankSnapshot `json:"tanksP1"`
+	TanksP2 []TankSnapshot `json:"tanksP2"`
+	// delayed shells landing at the start of the next turn
+	Shells []ShellSnapshot `json:"shells,omitempty"`
+	TurnP1 bool            `json:"turnP1"`
+	Turn   int             `json:"turn"`
+	Radius int             `json:"radius"`
+}
+
+func snapshotTanks(tanks map[int]*Tank) []TankSnapshot {
+	snapshot := []TankSnapshot{}
+	for _, t := range sortedTanks(tanks) {
+		snapshot = append(snapshot, TankSnapshot{t.id, t.p, t.visible, t.destroyed, t.seen, t.hp})
+	}
+	return snapshot
+}
+
+// Snapshot must only be taken between turns.
+func (gs *GameState) Snapshot() GameStateSnapshot {
+	hexes := []HexSnapshot{}
+	for _, h := range gs.hexes {
+		hexes = append(hexes, HexSnapshot{h.p, h.traversable})
+	}
+	sort.Slice(hexes, func(i, j int) bool {
+		a, b := hexes[i].P, hexes[j].P
+		return a.X < b.X || a.X == b.X && a.Y < b.Y
+	})
+
+	shells := []ShellSnapshot{}
+	for _, s := range gs.shells {
+		shells = append(shells, ShellSnapshot{s.id, s.target, s.splash})
+	}
+
+	return GameStateSnapshot{
+		Version: SnapshotVersion,
+		Map:     gs.cfg.MapConfig(),
+		P1First: gs.cfg.p1First,
+		Hexes:   hexes,
+		TanksP1: snapshotTanks(gs.tanksP1),
+		TanksP2: snapshotTanks(gs.tanksP2),
+		Shells:  shells,
+		TurnP1:  gs.turnP1,
+		Turn:    gs.turn,
+		Radius:  gs.radius,
+	}
+}
+
+// restoreTanks takes the class from the tanks of the map.
+func restoreTanks(cfg GameConfig, snapshot []TankSnapshot, configs []TankConfig) (map[int]*Tank, error) {
+	byId := make(map[int]TankConfig)
+	for _, tc := range configs {
+		byId[tc.Id] = tc
+	}
+	tanks := make(map[int]*Tank)
+	for _, t := range snapshot {
+		if _, ok := tanks[t.Id]; ok {
+			return nil, fmt.Errorf("duplicate tank %d", t.Id)
+		}
+		tc, ok := byId[t.Id]
+		if !ok {
+			return nil, fmt.Errorf("tank %d isnt on the map", t.Id)
+		}
+		tanks[t.Id] = &Tank{
+			id:        t.Id,
+			p:         t.P,
+			visible:   t.Visible,
+			destroyed: t.Destroyed,
+			seen:      t.Seen,
+			hp:        t.HP,
+			class:     cfg.tankClass(tc),
+		}
+	}
+	return tanks, nil
+}
+
+// RestoreGameState rebuilds a game from a snapshot, it resolves the following
+// turns exactly like the game the snapshot was taken from.
+func RestoreGameState(s GameStateSnapshot) (*GameState, error) {
+	if s.Version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	cfg, err := s.Map.GameConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg.p1First = s.P1First
+
+	hexes := make(map[Vector]*Hex)
+	for _, h := range s.Hexes {
+		hexes[h.P] = &Hex{h.P, h.Traversable}
+	}
+	tanksP1, err := restoreTanks(cfg, s.TanksP1, cfg.tanksP1)
+	if err != nil {
+		return nil, err
+	}
+	tanksP2, err := restoreTanks(cfg, s.TanksP2, cfg.tanksP2)
+	if err != nil {
+		return nil, err
+	}
+
+	shells := []Shell{}
+	for _, sh := range s.Shells {
+		shells = append(shells, Shell{sh.Id, sh.Target, sh.Splash})
+	}
+
+	return &GameState{
+		cfg:     cfg,
+		tanksP1: tanksP1,
+		tanksP2: tanksP2,
+		hexes:   hexes,
+		terrain: cfg.terrainMap(),
+		shells:  shells,
+		turnP1:  s.TurnP1,
+		turn:    s.Turn,
+		radius:  s.Radius,
+	}, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// playTurn lets both bots act on the game and hands them their results.
+func playTurn(t *testing.T, gs *GameState, b1, b2 *Bot) ([]TankAction, []TankAction, []byte) {
+	t.Helper()
+	a1, a2 := b1.actions(), b2.actions()
+	results1, results2 := gs.ResolveActions(a1, a2)
+	b1.apply(results1)
+	b2.apply(results2)
+	data, err := json.Marshal([][]TurnResult{results1, results2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a1, a2, data
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	classes := []string{"scout", "main_battle_tank", "artillery", "tank_destroyer"}
+	for seed := uint64(1); seed <= 20; seed++ {
+		params := NewDefaultMapGenParams(seed)
+		params.Tanks = 4
+		params.Classes = classes
+		gc, err := GenerateMap(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gs := NewGameState(gc)
+		cfg1, cfg2 := gs.ClientConfigs()
+		b1, b2 := NewBot(), NewBot()
+		b1.reset(cfg1)
+		b2.reset(cfg2)
+
+		for range 3 {
+			playTurn(t, gs, b1, b2)
+		}
+		data, err := json.Marshal(gs.Snapshot())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var snapshot GameStateSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			t.Fatal(err)
+		}
+		restored, err := RestoreGameState(snapshot)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+
+		for turn := 4; turn <= 20; turn++ {
+			a1, a2, want := playTurn(t, gs, b1, b2)
+			results1, results2 := restored.ResolveActions(a1, a2)
+			got, err := json.Marshal([][]TurnResult{results1, results2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("seed %d turn %d: restored game resolved\n%s\nwant\n%s", seed, turn, got, want)
+			}
+			if _, _, over := gs.Result(); over {
+				break
+			}
+		}
+	}
+}
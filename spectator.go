@@ -0,0 +1,188 @@
+package main
+
+type SpectatorView int
+
+const (
+	SpectatorOmniscient SpectatorView = 1
+	SpectatorPlayer1    SpectatorView = 2
+	SpectatorPlayer2    SpectatorView = 3
+)
+
+// RoomOptions are picked by the room creator, the options left out take the
+// server default.
+type RoomOptions struct {
+	SpectatorView *SpectatorView `json:"spectatorView,omitempty"`
+	// spectators receive turn results this many turns late
+	SpectatorDelay *int `json:"spectatorDelay,omitempty"`
+	// number of games in the series, the first to win a majority takes it
+	BestOf *int `json:"bestOf,omitempty"`
+	// name of a loaded map, empty picks the server default
+	Map string `json:"map"`
+	// layout seed for the generated map, left out picks a random one
+	Seed *uint64 `json:"seed,omitempty"`
+}
+
+// withDefaults takes every option left out from defaults, map and seed are
+// picked by the hub.
+func (o RoomOptions) withDefaults(defaults RoomOptions) RoomOptions {
+	if o.SpectatorView == nil {
+		o.SpectatorView = defaults.SpectatorView
+	}
+	if o.SpectatorDelay == nil {
+		o.SpectatorDelay = defaults.SpectatorDelay
+	}
+	if o.BestOf == nil {
+		o.BestOf = defaults.BestOf
+	}
+	return o
+}
+
+// normalized fixes options out of range and fills in any still left out, the
+// room reads them without checking.
+func (o RoomOptions) normalized() RoomOptions {
+	view := SpectatorOmniscient
+	if o.SpectatorView != nil {
+		switch *o.SpectatorView {
+		case SpectatorOmniscient, SpectatorPlayer1, SpectatorPlayer2:
+			view = *o.SpectatorView
+		}
+	}
+	delay := 0
+	if o.SpectatorDelay != nil {
+		delay = max(*o.SpectatorDelay, 0)
+	}
+	bestOf := 1
+	if o.BestOf != nil {
+		bestOf = max(*o.BestOf, 1)
+	}
+	o.SpectatorView, o.SpectatorDelay, o.BestOf = &view, &delay, &bestOf
+	return o
+}
+
+type Spectator struct {
+	chans RoomChans
+	// number of turns from the spectator stream already sent
+	sent    int
+	removed chan struct{}
+}
+
+func (r *Room) addSpectator(chans RoomChans) {
+	s := &Spectator{chans: chans, removed: make(chan struct{})}
+	r.spectators = append(r.spectators, s)
+
+	// spectators only ever tell the room they are leaving, so the first
+	// message is all the room needs to hear
+	go func(s *Spectator, left chan *Spectator) {
+		select {
+		case <-s.chans.send:
+			select {
+			case left <- s:
+			case <-s.removed:
+			}
+		case <-s.removed:
+		}
+	}(s, r.spectatorLeft)
+
+	s.chans.read <- RoomMessage{msgType: RoomJoined, code: r.code}
+	r.sendSpectatorStart(s)
+	r.sendSpectatorResults(s, false)
+}
+
+func (r *Room) removeSpectator(s *Spectator) {
+	for i, spectator := range r.spectators {
+		if spectator == s {
+			r.spectators = append(r.spectators[:i], r.spectators[i+1:]...)
+			close(s.removed)
+			close(s.chans.read)
+			return
+		}
+	}
+}
+
+func (r *Room) sendSpectatorStart(s *Spectator) {
+	cfg1, cfg2 := r.gamestate.ClientConfigs()
+	cfg := cfg1
+	if *r.options.SpectatorView == SpectatorPlayer2 {
+		cfg = cfg2
+	}
+	s.chans.read <- RoomMessage{msgType: RoomGameStarted, config: cfg}
+
+	if *r.options.SpectatorView != SpectatorOmniscient {
+		return
+	}
+	// the omniscient stream carries no visibility changes, so reveal the
+	// enemy side once up front
+	reveal := []TurnResult{}
+	for _, t := range cfg.EnemyTanks {
+		reveal = append(reveal, newTurnResultVisible(t.Id, t.P, true))
+	}
+	s.chans.read <- RoomMessage{msgType: RoomTurnResult, turnResults: reveal}
+}
+
+// sendSpectatorResults catches the spectator up with the stream, holding back
+// the configured number of turns unless flush is set.
+func (r *Room) sendSpectatorResults(s *Spectator, flush bool) {
+	upTo := len(r.spectatorResults)
+	if !flush {
+		upTo -= *r.options.SpectatorDelay
+	}
+	for ; s.sent < upTo; s.sent++ {
+		s.chans.read <- RoomMessage{
+			msgType:     RoomTurnResult,
+			turnResults: r.spectatorResults[s.sent],
+		}
+	}
+}
+
+func (r *Room) recordSpectatorResults(results1, results2 []TurnResult) {
+	results := r.gamestate.OmniscientResults()
+	switch *r.options.SpectatorView {
+	case SpectatorPlayer1:
+		results = withoutActionOutcomes(results1)
+	case SpectatorPlayer2:
+		results = withoutActionOutcomes(results2)
+	}
+	r.spectatorResults = append(r.spectatorResults, results)
+	for _, s := range r.spectators {
+		r.sendSpectatorResults(s, false)
+	}
+}
+
+// withoutActionOutcomes drops the feedback meant only for the player who
+// submitted the actions.
+func withoutActionOutcomes(results []TurnResult) []TurnResult {
+	filtered := make([]TurnResult, 0, len(results))
+	for _, res := range results {
+		if _, ok := res.(TurnResultAction); !ok {
+			filtered = append(filtered, res)
+		}
+	}
+	return filtered
+}
+
+func (r *Room) restartSpectators() {
+	r.spectatorResults = nil
+	for _, s := range r.spectators {
+		s.sent = 0
+		r.sendSpectatorStart(s)
+	}
+}
+
+func (r *Room) finishSpectators(resultP1, resultP2 GameResult) {
+	result := resultP1
+	if *r.options.SpectatorView == SpectatorPlayer2 {
+		result = resultP2
+	}
+	for _, s := range r.spectators {
+		r.sendSpectatorResults(s, true)
+		s.chans.read <- RoomMessage{msgType: RoomGameFinished, gameResult: result}
+	}
+}
+
+func (r *Room) closeSpectators() {
+	for _, s := range r.spectators {
+		close(s.removed)
+		close(s.chans.read)
+	}
+	r.spectators = nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// the client has to be built with tsc before the server for the scripts to
+// be embedded
+//
+//go:embed web/dist
+var webDist embed.FS
+
+type staticAsset struct {
+	contentType string
+	content     []byte
+	// nil when compressing doesnt pay off
+	gzipped []byte
+	etag    string
+}
+
+// StaticHandler serves a file tree held in memory, every file is hashed and
+// compressed once up front.
+type StaticHandler struct {
+	assets map[string]*staticAsset
+	maxAge time.Duration
+}
+
+func EmbeddedWebDist() fs.FS {
+	dist, err := fs.Sub(webDist, "web/dist")
+	if err != nil {
+		panic(err)
+	}
+	return dist
+}
+
+func NewStaticHandler(fsys fs.FS, maxAge time.Duration) (*StaticHandler, error) {
+	h := &StaticHandler{assets: make(map[string]*staticAsset), maxAge: maxAge}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		asset, err := newStaticAsset(name, content)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		h.assets[name] = asset
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func newStaticAsset(name string, content []byte) (*staticAsset, error) {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+	sum := sha256.Sum256(content)
+	asset := &staticAsset{
+		contentType: contentType,
+		content:     content,
+		etag:        hex.EncodeToString(sum[:8]),
+	}
+	if !compressible(contentType) {
+		return asset, nil
+	}
+
+	buf := bytes.Buffer{}
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() < len(content) {
+		asset.gzipped = buf.Bytes()
+	}
+	return asset, nil
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/javascript", "text/javascript", "application/json", "image/svg+xml":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/")
+}
+
+func (h *StaticHandler) Len() int {
+	return len(h.assets)
+}
+
+func (h *StaticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+	asset, ok := h.assets[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", asset.contentType)
+	// pages are revalidated every time so a deploy shows up on the next load,
+	// the rest may be cached for a while
+	if path.Ext(name) == ".html" {
+		header.Set("Cache-Control", "no-cache")
+	} else {
+		header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.maxAge.Seconds())))
+	}
+
+	content := asset.content
+	etag := asset.etag
+	if asset.gzipped != nil {
+		header.Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			content = asset.gzipped
+			etag += "-gz"
+			header.Set("Content-Encoding", "gzip")
+		}
+	}
+	header.Set("ETag", `"`+etag+`"`)
+	// ServeContent answers If-None-Match and range requests from the ETag
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package main
+
+import "fmt"
+
+// TerrainType gives the hexes of one variant their rules, hexes whose variant
+// has no entry are open ground.
+type TerrainType struct {
+	Variant int    `json:"variant"`
+	Name    string `json:"name"`
+	// part of driveRange used up by driving onto the hex
+	Cost       int  `json:"cost"`
+	Impassable bool `json:"impassable,omitempty"`
+	// stops line of sight like a site
+	BlocksSight bool `json:"blocksSight,omitempty"`
+	// the hex, and whatever is on it, is seen from this much closer
+	Concealment int `json:"concealment,omitempty"`
+}
+
+var openTerrain = TerrainType{Name: "open", Cost: 1}
+
+func (gc GameConfig) validateTerrain() []error {
+	errs := []error{}
+	visibilityRange := gc.minVisibilityRange()
+	variants := make(map[int]bool)
+	for _, t := range gc.terrain {
+		if variants[t.Variant] {
+			errs = append(errs, fmt.Errorf("terrain for variant %d listed twice", t.Variant))
+		}
+		variants[t.Variant] = true
+		if !t.Impassable && t.Cost < 1 {
+			errs = append(errs, fmt.Errorf("terrain %q needs a positive cost", t.Name))
+		}
+		if t.Concealment < 0 || t.Concealment >= visibilityRange {
+			errs = append(errs, fmt.Errorf("terrain %q concealment must be below the visibility range of every tank", t.Name))
+		}
+	}
+
+	terrain := gc.terrainMap()
+	for _, t := range append(append([]TankConfig{}, gc.tanksP1...), gc.tanksP2...) {
+		if terrain[t.P].Impassable {
+			errs = append(errs, fmt.Errorf("tank %d starts on impassable terrain", t.Id))
+		}
+	}
+	return errs
+}
+
+func (gc GameConfig) terrainMap() map[Vector]TerrainType {
+	return terrainByHex(gc.hexes, gc.terrain)
+}
+
+// terrainByHex looks up the terrain of every hex.
+func terrainByHex(hexes []SceneConfig, types []TerrainType) map[Vector]TerrainType {
+	byVariant := make(map[int]TerrainType)
+	for _, t := range types {
+		byVariant[t.Variant] = t
+	}
+	terrain := make(map[Vector]TerrainType)
+	for _, h := range hexes {
+		t, ok := byVariant[h.Variant]
+		if !ok {
+			t = openTerrain
+		}
+		terrain[h.P] = t
+	}
+	return terrain
+}
+
+func (gs *GameState) terrainAt(p Vector) TerrainType {
+	t, ok := gs.terrain[p]
+	if !ok {
+		return openTerrain
+	}
+	return t
+}
@@ -12,6 +12,10 @@ type Vector struct {
 	Y int `json:"y"`
 }
 
+var unitVectors = []Vector{
+	{1, 0}, {1, -1}, {0, -1}, {-1, 0}, {-1, 1}, {0, 1},
+}
+
 func newZeroVector() Vector {
 	return Vector{0, 0}
 }
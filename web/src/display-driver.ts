@@ -330,7 +330,10 @@ export class DisplayDriver {
     }
 
     for (const tank of this.gameState.playerTanks) {
-      if (tank.shooting) {
+      if (tank.shooting && tank.target !== null) {
+        const sprite = this.getHighlightSprite(GREEN_HIGHLIGHT_IDX);
+        this.drawSprite(sprite, tank.target);
+      } else if (tank.shooting) {
         const sprite = this.getAimSprite(tank.shootingDir);
         this.drawSprite(sprite, tank.p);
       }
@@ -399,6 +402,7 @@ export class DisplayDriver {
       );
       this.drawSprite(sprite.body, tank.pF);
       this.drawSprite(sprite.turret, tank.pF);
+      this.drawHealthBar(tank);
     }
     for (const tank of this.gameState.enemyTanks) {
       if (!tank.visible) continue;
@@ -409,9 +413,36 @@ export class DisplayDriver {
       );
       this.drawSprite(sprite.body, tank.pF);
       this.drawSprite(sprite.turret, tank.pF);
+      this.drawHealthBar(tank);
     }
   }
 
+  // tanks destroyed by a single hit dont get a bar
+  private drawHealthBar(tank: Tank) {
+    if (tank.maxHp <= 1) return;
+    const scale = this.curPreset.scale;
+    const hexSize = this.getHexSize();
+    const shakeOffset = (this.gameState?.cameraShake || Vector.zero()).mul(
+      this.curPreset.sprites.hexSize.x * scale,
+    );
+    const center = this.gridToScreenCoords(tank.pF).add(shakeOffset);
+    const width = Math.round(hexSize.x * 0.5);
+    const height = Math.max(2, Math.round(scale * 2));
+    const start = center
+      .add(new Vector(-width / 2, hexSize.y * 0.3))
+      .floor();
+
+    this.ctx.fillStyle = "black";
+    this.ctx.fillRect(start.x - 1, start.y - 1, width + 2, height + 2);
+    this.ctx.fillStyle = tank.hp * 3 > tank.maxHp ? "#4caf50" : "#e53935";
+    this.ctx.fillRect(
+      start.x,
+      start.y,
+      Math.round((width * tank.hp) / tank.maxHp),
+      height,
+    );
+  }
+
   private getHexSize(): Vector {
     return this.curPreset.sprites.hexSize.mul(this.curPreset.scale);
   }
@@ -1,5 +1,5 @@
 import { SHRINK_MARK_IDX, SMOKE_MARK_IDX } from "./display-driver.js";
-import { Vector } from "./vector.js";
+import { Vector, canSee } from "./vector.js";
 
 export function getTankById(tanks: Tank[], id: number): Tank | null {
   for (const tank of tanks) {
@@ -19,6 +19,7 @@ export enum GameResult {
 enum TankActionType {
   Move = 1,
   Fire = 2,
+  IndirectFire = 3,
 }
 
 export type TankMove = {
@@ -33,6 +34,19 @@ export type TankFire = {
   dir: Vector;
 };
 
+export type TankIndirectFire = {
+  type: TankActionType.IndirectFire;
+  id: number;
+  target: Vector;
+};
+
+export function newTankIndirectFire(
+  id: number,
+  target: Vector,
+): TankIndirectFire {
+  return { type: TankActionType.IndirectFire, id: id, target: target };
+}
+
 export function newTankFire(id: number, dir: Vector): TankFire {
   return { type: TankActionType.Fire, id: id, dir: dir };
 }
@@ -41,24 +55,104 @@ export function newTankMove(id: number, path: Vector[]): TankMove {
   return { type: TankActionType.Move, id: id, path: path };
 }
 
-export type TankAction = TankMove | TankFire;
+export type TankAction = TankMove | TankFire | TankIndirectFire;
 
 export type GameConfig = {
+  map: string;
   hexes: { p: Vector; variant: number }[];
-  playerTanks: { id: number; p: Vector }[];
-  enemyTanks: { id: number; p: Vector }[];
+  playerTanks: TankConfig[];
+  enemyTanks: TankConfig[];
   sites: { p: Vector; variant: number }[];
   driveRange: number;
   visibilityRange: number;
   fireRange: number;
   center: Vector;
+  visibility: VisibilityModel;
+  terrain: TerrainType[];
+  damage: number;
+  damageFalloff: number;
+  classes: TankClass[];
+};
+
+// a tank without class uses the ranges of the map and is destroyed by its
+// first hit, hp and armor win over the class
+export type TankConfig = {
+  id: number;
+  p: Vector;
+  class?: string;
+  hp?: number;
+  armor?: number;
+};
+
+export type TankClass = {
+  name: string;
+  driveRange: number;
+  visibilityRange: number;
+  fireRange: number;
+  hp: number;
+  armor?: number;
+  // a class without indirectMaxRange has no indirect fire
+  indirectMinRange?: number;
+  indirectMaxRange?: number;
+  splashDamage?: number;
+  indirectDelayed?: boolean;
+};
+
+export function canFireAt(tank: Tank, p: Vector): boolean {
+  const max = tank.class.indirectMaxRange ?? 0;
+  const min = tank.class.indirectMinRange ?? 0;
+  const d = tank.p.gridDistance(p);
+  return max > 0 && d >= min && d <= max;
+}
+
+// mirrors resolveTankClass on the server
+export function resolveTankClass(
+  config: GameConfig,
+  tank: TankConfig,
+): TankClass {
+  let tankClass: TankClass = {
+    name: "",
+    driveRange: config.driveRange,
+    visibilityRange: config.visibilityRange,
+    fireRange: config.fireRange,
+    hp: 1,
+  };
+  const found = config.classes.find((c) => c.name === tank.class);
+  if (found !== undefined) {
+    tankClass = { ...found };
+  }
+  if (tank.hp !== undefined) {
+    tankClass.hp = tank.hp;
+  }
+  if (tank.armor !== undefined) {
+    tankClass.armor = tank.armor;
+  }
+  return tankClass;
+}
+
+// hexes with a variant missing from the terrain table are open ground
+export type TerrainType = {
+  variant: number;
+  name: string;
+  cost: number;
+  impassable?: boolean;
+  blocksSight?: boolean;
+  concealment?: number;
 };
 
+export enum VisibilityModel {
+  Range = "range",
+  LineOfSight = "line_of_sight",
+}
+
 export type Hex = {
   p: Vector;
   variant: number;
   traversable: boolean;
   opacity: number;
+  cost: number;
+  blocksSight: boolean;
+  concealment: number;
 };
 
 export type Explosion = {
@@ -81,6 +175,11 @@ export type Tank = {
   shooting: boolean;
   shootingDir: number;
   visible: boolean;
+  hp: number;
+  maxHp: number;
+  class: TankClass;
+  // aim of indirect fire, shooting at shootingDir when null
+  target: Vector | null;
 };
 
 export type Overlay = {
@@ -104,6 +203,9 @@ export enum TurnResultType {
   Destroyed = 5,
   Visible = 6,
   Shrink = 7,
+  Action = 8,
+  Damage = 9,
+  IndirectFire = 10,
   EndTurn = 1 << 8,
 }
 
@@ -129,6 +231,13 @@ export type TurnResultFire = {
   dir: Vector;
 };
 
+export type TurnResultIndirectFire = {
+  type: TurnResultType.IndirectFire;
+  id: number;
+  target: Vector;
+  delayed: boolean;
+};
+
 export type TurnResultExplosion = {
   type: TurnResultType.Explosion;
   p: Vector;
@@ -142,6 +251,14 @@ export type TurnResultDestroyed = {
   id: number;
 };
 
+export type TurnResultDamage = {
+  type: TurnResultType.Damage;
+  id: number;
+  p: Vector;
+  damage: number;
+  hp: number;
+};
+
 export type TurnResultVisible = {
   type: TurnResultType.Visible;
   id: number;
@@ -155,6 +272,21 @@ export type TurnResultShrink = {
   started: boolean;
 };
 
+export enum ActionStatus {
+  Accepted = 1,
+  Truncated = 2,
+  Rejected = 3,
+}
+
+export type TurnResultAction = {
+  type: TurnResultType.Action;
+  index: number;
+  id: number;
+  status: ActionStatus;
+  at: number;
+  reason: string;
+};
+
 export type TurnResultEndTurn = {
   type: TurnResultType.EndTurn;
 };
@@ -163,10 +295,13 @@ export type TurnResult =
   | TurnResultMove2
   | TurnResultMove3
   | TurnResultFire
+  | TurnResultIndirectFire
   | TurnResultExplosion
   | TurnResultDestroyed
   | TurnResultVisible
   | TurnResultShrink
+  | TurnResultAction
+  | TurnResultDamage
   | TurnResultEndTurn;
 
 export class GameState {
@@ -184,11 +319,23 @@ export class GameState {
   cameraShake: Vector = Vector.zero();
 
   constructor(config: GameConfig) {
+    const terrain = new Map(config.terrain.map((t) => [t.variant, t]));
     this.hexes = new Map(
-      config.hexes.map((h) => [
-        h.p.toString(),
-        { p: h.p, variant: h.variant, traversable: true, opacity: 1 },
-      ]),
+      config.hexes.map((h) => {
+        const t = terrain.get(h.variant);
+        return [
+          h.p.toString(),
+          {
+            p: h.p,
+            variant: h.variant,
+            traversable: !(t?.impassable ?? false),
+            opacity: 1,
+            cost: t?.cost ?? 1,
+            blocksSight: t?.blocksSight ?? false,
+            concealment: t?.concealment ?? 0,
+          },
+        ];
+      }),
     );
     this.sites = config.sites.map((s) => ({ p: s.p, variant: s.variant }));
 
@@ -199,37 +346,73 @@ export class GameState {
       }
     }
 
-    this.playerTanks = config.playerTanks.map((t) => ({
-      id: t.id,
-      p: t.p,
-      pF: t.p,
-      angleBody: 120,
-      angleTurret: 134,
-      path: [],
-      shooting: false,
-      shootingDir: 0,
-      visible: true,
-    }));
-
-    this.enemyTanks = config.enemyTanks.map((t) => ({
-      id: t.id,
-      p: t.p,
-      pF: t.p,
-      angleBody: 304,
-      angleTurret: 288,
-      path: [],
-      shooting: false,
-      shootingDir: 0,
-      visible: false,
-    }));
-
+    this.playerTanks = config.playerTanks.map((t) => {
+      const tankClass = resolveTankClass(config, t);
+      return {
+        id: t.id,
+        p: t.p,
+        pF: t.p,
+        angleBody: 120,
+        angleTurret: 134,
+        path: [],
+        shooting: false,
+        shootingDir: 0,
+        visible: true,
+        hp: tankClass.hp,
+        maxHp: tankClass.hp,
+        class: tankClass,
+        target: null,
+      };
+    });
+
+    this.enemyTanks = config.enemyTanks.map((t) => {
+      const tankClass = resolveTankClass(config, t);
+      return {
+        id: t.id,
+        p: t.p,
+        pF: t.p,
+        angleBody: 304,
+        angleTurret: 288,
+        path: [],
+        shooting: false,
+        shootingDir: 0,
+        visible: false,
+        hp: tankClass.hp,
+        maxHp: tankClass.hp,
+        class: tankClass,
+        target: null,
+      };
+    });
+
+    const lineOfSight = config.visibility === VisibilityModel.LineOfSight;
     for (const et of this.enemyTanks.values()) {
       for (const pt of this.playerTanks.values()) {
-        if (pt.p.gridDistance(et.p) <= config.visibilityRange) {
+        if (
+          canSee(
+            pt.p,
+            et.p,
+            pt.class.visibilityRange - this.concealment(et.p),
+            lineOfSight,
+            (p) => this.blocksSight(p),
+          )
+        ) {
           et.visible = true;
           break;
         }
       }
     }
   }
+
+  public blocksSight(p: Vector): boolean {
+    const hex = this.hexes.get(p.toString());
+    if (hex === undefined) {
+      return false;
+    }
+    const isSite = this.sites.some((s) => s.p.eq(p));
+    return isSite || hex.blocksSight;
+  }
+
+  public concealment(p: Vector): number {
+    return this.hexes.get(p.toString())?.concealment ?? 0;
+  }
 }
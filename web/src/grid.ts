@@ -2,27 +2,32 @@ import { AudioDriver } from "./audio-driver.js";
 import { DisplayDriver } from "./display-driver.js";
 import { GameEventType } from "./game-event.js";
 import {
+  canFireAt,
   GameConfig,
   GameState,
   getTankById,
   newShrinkMark,
   newSmokeMark,
   newTankFire,
+  newTankIndirectFire,
   newTankMove,
   Tank,
   TankAction,
   TurnResult,
+  TurnResultDamage,
   TurnResultDestroyed,
   TurnResultExplosion,
-  TurnResultFire,
   TurnResultMove2,
   TurnResultMove3,
   TurnResultShrink,
   TurnResultType,
   TurnResultVisible,
+  VisibilityModel,
 } from "./game-objects.js";
 import { Notifier } from "./notifier.js";
 import {
+  canSee,
+  hexLine,
   idxToUnitVector,
   includesVector,
   interpolatePath,
@@ -55,8 +60,7 @@ export class Grid {
   displayDriver: DisplayDriver;
   notifier: Notifier;
   config: {
-    driveRange: number;
-    visibilityRange: number;
+    lineOfSight: boolean;
     center: Vector;
   };
   lastPoint: Vector = Vector.zero();
@@ -84,8 +88,7 @@ export class Grid {
     this.gameState = gameState;
     this.displayDriver = displayDriver;
     this.config = {
-      driveRange: config.driveRange,
-      visibilityRange: config.visibilityRange,
+      lineOfSight: config.visibility === VisibilityModel.LineOfSight,
       center: config.center,
     };
     this.recalculateVisibleHexes();
@@ -130,7 +133,14 @@ export class Grid {
     if (this.curResult.type === TurnResultType.Fire) {
       const tank = this.getTank(this.curResult.id);
       if (tank === null) return new ResolverError(this);
-      return new ResolverFire(this, this.curResult, tank);
+      return new ResolverFire(this, this.curResult.dir, tank);
+    }
+    if (this.curResult.type === TurnResultType.IndirectFire) {
+      const tank = this.getTank(this.curResult.id);
+      if (tank === null) return new ResolverError(this);
+      // the turret turns to the first hex on the way to the target
+      const dir = hexLine(tank.p, this.curResult.target, 1)[1].sub(tank.p);
+      return new ResolverFire(this, dir, tank);
     }
     if (this.curResult.type === TurnResultType.Explosion) {
       if (this.curResult.destroyed) {
@@ -152,7 +162,9 @@ export class Grid {
     for (const idx of this.gameState.turnOrder) {
       const tank = getTankById(this.gameState.playerTanks, idx);
       if (tank === null) continue;
-      if (tank.shooting) {
+      if (tank.shooting && tank.target !== null) {
+        actions.push(newTankIndirectFire(idx, tank.target));
+      } else if (tank.shooting) {
         const shootingVec = idxToUnitVector(tank.shootingDir);
         if (shootingVec === null) continue;
         actions.push(newTankFire(idx, shootingVec));
@@ -179,6 +191,7 @@ export class Grid {
       tank.path = [];
       tank.shooting = false;
       tank.shootingDir = 0;
+      tank.target = null;
       this.curTank = tank;
       this.recalculateTraversable();
       this.saveOrder(tank.id);
@@ -207,6 +220,7 @@ export class Grid {
           this.curTank.shootingDir = 0;
           this.gameState.availableHexes.clear();
           this.gameState.conditionallyAvailableHexes.clear();
+          this.showIndirectTargets(this.curTank);
           this.handleTankFire(p);
         } else {
           this.handleTankNavigation(p);
@@ -302,6 +316,7 @@ export class Grid {
       tank.path = [];
       tank.shooting = false;
       tank.shootingDir = 0;
+      tank.target = null;
     }
   }
 
@@ -322,8 +337,27 @@ export class Grid {
     this.displayDriver.addCameraOffset(p.sub(this.lastPoint));
   }
 
+  // hexes in indirect range are marked while aiming, pointing at one of them
+  // fires over any blockers instead of straight ahead
+  private showIndirectTargets(tank: Tank) {
+    for (const hex of this.gameState.hexes.values()) {
+      if (canFireAt(tank, hex.p)) {
+        this.gameState.conditionallyAvailableHexes.add(hex.p.toString());
+      }
+    }
+  }
+
   private handleTankFire(p: Vector) {
     if (this.curTank === null) return;
+    const gridP = this.displayDriver.screenToGridCoords(p);
+    if (
+      canFireAt(this.curTank, gridP) &&
+      this.gameState.hexes.has(gridP.toString())
+    ) {
+      this.curTank.target = gridP;
+      return;
+    }
+    this.curTank.target = null;
     const v = p.sub(this.displayDriver.gridToScreenCoords(this.curTank.p));
     this.curTank.shootingDir = Math.floor((v.angle() + 30) / 60) % 6;
   }
@@ -331,7 +365,7 @@ export class Grid {
   private handleTankNavigation(p: Vector) {
     if (this.curTank === null) return;
     const gridP = this.displayDriver.screenToGridCoords(p);
-    if (this.curTank.path.length > this.config.driveRange) return;
+    if (this.curTank.path.length > this.curTank.class.driveRange) return;
     if (gridP.eq(this.curTank.p)) return;
     const lastOnPath =
       this.curTank.path.length > 0
@@ -364,10 +398,12 @@ export class Grid {
       return;
     }
     let start = this.curTank.p;
-    let range = this.config.driveRange;
+    let range = this.curTank.class.driveRange;
     if (this.curTank.path.length > 0) {
       start = this.curTank.path[this.curTank.path.length - 1];
-      range -= this.curTank.path.length - 1;
+      for (const p of this.curTank.path.slice(1)) {
+        range -= this.gameState.hexes.get(p.toString())?.cost ?? 1;
+      }
     }
     if (range <= 0) {
       return;
@@ -403,31 +439,31 @@ export class Grid {
       return;
     }
 
+    // cheapest cost of every hex found so far, a hex is visited again
+    // whenever a cheaper way to it turns up
+    const costs: Map<string, number> = new Map([[start.toString(), 0]]);
     let frontier = [start];
-    set.add(start.toString());
-
-    for (let i = 0; i < range; i++) {
-      let newFrontier = [];
-      for (const p of frontier) {
-        for (const n of p.neighbors()) {
-          if (set.has(n.toString())) {
-            continue;
-          }
-          const hex = this.gameState.hexes.get(n.toString());
-          if (hex === undefined || !hex.traversable) {
-            continue;
-          }
-          if (unavailable.has(n.toString())) {
-            continue;
-          }
-          set.add(n.toString());
-          newFrontier.push(n);
+    while (frontier.length > 0) {
+      const p = frontier.shift()!;
+      const cost = costs.get(p.toString())!;
+      for (const n of p.neighbors()) {
+        const hex = this.gameState.hexes.get(n.toString());
+        if (hex === undefined || !hex.traversable) {
+          continue;
+        }
+        if (unavailable.has(n.toString()) || n.eq(start)) {
+          continue;
         }
+        const nCost = cost + hex.cost;
+        const known = costs.get(n.toString());
+        if (nCost > range || (known !== undefined && known <= nCost)) {
+          continue;
+        }
+        costs.set(n.toString(), nCost);
+        set.add(n.toString());
+        frontier.push(n);
       }
-      frontier = newFrontier;
     }
-
-    set.delete(start.toString());
   }
 
   public recalculateVisibleHexes() {
@@ -436,7 +472,15 @@ export class Grid {
     for (const tank of this.gameState.playerTanks) {
       if (!tank.visible) continue;
       for (const hex of this.gameState.hexes.values()) {
-        if (tank.p.gridDistance(hex.p) <= this.config.visibilityRange) {
+        if (
+          canSee(
+            tank.p,
+            hex.p,
+            tank.class.visibilityRange - hex.concealment,
+            this.config.lineOfSight,
+            (p) => this.gameState.blocksSight(p),
+          )
+        ) {
           this.gameState.visibleHexes.add(hex.p.toString());
         }
       }
@@ -776,14 +820,14 @@ class ResolverFire implements Resolver {
 
   playedFiringSound = false;
 
-  constructor(grid: Grid, result: TurnResultFire, tank: Tank) {
+  constructor(grid: Grid, dir: Vector, tank: Tank) {
     this.grid = grid;
     this.tank = tank;
     this.startT = this.grid.curT;
 
     this.startAngle = tank.angleBody;
     this.turretOffset = normalize180(tank.angleTurret - tank.angleBody);
-    this.endAngle = unitVectorToIdx(result.dir) * 60;
+    this.endAngle = unitVectorToIdx(dir) * 60;
 
     const absAngleBetweenBodyAndDir = Math.abs(
       normalize180(this.endAngle - tank.angleBody),
@@ -806,7 +850,7 @@ class ResolverFire implements Resolver {
 
     this.tFiring = FIRING_DURATION;
     this.tPause = FIRING_PAUSE;
-    this.pFiring = this.tank.p.add(result.dir.mul(0.3));
+    this.pFiring = this.tank.p.add(dir.mul(0.3));
   }
 
   animate() {
@@ -1010,6 +1054,9 @@ class ResolverRest implements Resolver {
       case TurnResultType.Destroyed:
         this.resolveDestroyed(this.turnResult);
         break;
+      case TurnResultType.Damage:
+        this.resolveDamage(this.turnResult);
+        break;
       case TurnResultType.Shrink:
         if (this.turnResult.started) {
           for (const [key, hex] of this.grid.gameState.hexes.entries()) {
@@ -1033,6 +1080,14 @@ class ResolverRest implements Resolver {
     this.grid.gameState.overlays.push(newSmokeMark(res.p));
   }
 
+  private resolveDamage(res: TurnResultDamage) {
+    const tank =
+      getTankById(this.grid.gameState.playerTanks, res.id) ||
+      getTankById(this.grid.gameState.enemyTanks, res.id);
+    if (tank === null) return;
+    tank.hp = res.hp;
+  }
+
   private resolveVisibility(res: TurnResultVisible) {
     const tank = getTankById(this.grid.gameState.enemyTanks, res.id);
     if (tank === null) return;
@@ -128,6 +128,73 @@ export function isNeighbor(p1: Vector, p2: Vector): boolean {
   return false;
 }
 
+// LINE_SCALE and the rounding below mirror sight.go, server and client must
+// agree on every line.
+const LINE_SCALE = 1 << 20;
+
+function divRound(v: number, den: number): number {
+  return Math.floor((2 * v + den) / (2 * den));
+}
+
+function roundHex(x: number, y: number, den: number): Vector {
+  const z = -x - y;
+  let rx = divRound(x, den);
+  let ry = divRound(y, den);
+  const rz = divRound(z, den);
+  const dx = Math.abs(x - rx * den);
+  const dy = Math.abs(y - ry * den);
+  const dz = Math.abs(z - rz * den);
+  if (dx > dy && dx > dz) {
+    rx = -ry - rz;
+  } else if (dy > dz) {
+    ry = -rx - rz;
+  }
+  return new Vector(rx, ry);
+}
+
+export function hexLine(a: Vector, b: Vector, side: number): Vector[] {
+  const n = a.gridDistance(b);
+  if (n === 0) {
+    return [a.copy()];
+  }
+  const den = n * LINE_SCALE;
+  const line = [];
+  for (let i = 0; i <= n; i++) {
+    const x = (a.x * (n - i) + b.x * i) * LINE_SCALE + side;
+    const y = (a.y * (n - i) + b.y * i) * LINE_SCALE + 2 * side;
+    line.push(roundHex(x, y, den));
+  }
+  return line;
+}
+
+function clearLine(line: Vector[], blocks: (p: Vector) => boolean): boolean {
+  for (let i = 1; i < line.length - 1; i++) {
+    if (blocks(line[i])) {
+      return false;
+    }
+  }
+  return true;
+}
+
+export function canSee(
+  from: Vector,
+  to: Vector,
+  visibilityRange: number,
+  lineOfSight: boolean,
+  blocks: (p: Vector) => boolean,
+): boolean {
+  if (from.gridDistance(to) > visibilityRange) {
+    return false;
+  }
+  if (!lineOfSight) {
+    return true;
+  }
+  return (
+    clearLine(hexLine(from, to, 1), blocks) ||
+    clearLine(hexLine(from, to, -1), blocks)
+  );
+}
+
 export function includesVector(arr: Vector[], v: Vector) {
   for (const av of arr) {
     if (av.eq(v)) {
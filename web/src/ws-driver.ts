@@ -15,18 +15,34 @@ function vectorReviver(key: string, value: any) {
   return value;
 }
 
+type SeriesStatus = {
+  game: number;
+  bestOf: number;
+  wins: number;
+  losses: number;
+  draws: number;
+  finished: boolean;
+  result: GameResult;
+};
+
 enum ServerMessageType {
   StartGame = 1,
   TurnResults = 2,
   RoomJoined = 3,
   RoomDisconnected = 4,
   GameFinished = 5,
+  TurnDeadline = 6,
+  SeriesUpdate = 7,
+  Error = 8,
+  Shutdown = 9,
+  Notice = 10,
 }
 
 type ServerMessage =
   | {
       type: ServerMessageType.StartGame;
       config: GameConfig;
+      reconnectToken: string;
     }
   | {
       type: ServerMessageType.TurnResults;
@@ -34,6 +50,7 @@ type ServerMessage =
     }
   | {
       type: ServerMessageType.RoomJoined;
+      roomCode: string;
     }
   | {
       type: ServerMessageType.RoomDisconnected;
@@ -41,12 +58,39 @@ type ServerMessage =
   | {
       type: ServerMessageType.GameFinished;
       result: GameResult;
+    }
+  | {
+      type: ServerMessageType.TurnDeadline;
+      turn: number;
+      deadline: number;
+    }
+  | {
+      type: ServerMessageType.SeriesUpdate;
+      series: SeriesStatus;
+    }
+  | {
+      type: ServerMessageType.Error;
+      code: string;
+      detail: string;
+    }
+  | {
+      type: ServerMessageType.Shutdown;
+      deadline: number;
+    }
+  | {
+      type: ServerMessageType.Notice;
+      text: string;
     };
 
 enum ClientMessageType {
   JoinRoom = 1,
   SendTurn = 2,
   QuitRoom = 3,
+  FindMatch = 4,
+  Reconnect = 5,
+  Spectate = 6,
+  Rematch = 7,
+  PlayBot = 8,
 }
 
 type ClientMessage =
@@ -60,6 +104,24 @@ type ClientMessage =
     }
   | {
       type: ClientMessageType.QuitRoom;
+    }
+  | {
+      type: ClientMessageType.FindMatch;
+    }
+  | {
+      type: ClientMessageType.Reconnect;
+      roomCode: string;
+      token: string;
+    }
+  | {
+      type: ClientMessageType.Spectate;
+      roomCode: string;
+    }
+  | {
+      type: ClientMessageType.Rematch;
+    }
+  | {
+      type: ClientMessageType.PlayBot;
     };
 
 export class WsDriver {
@@ -90,6 +152,44 @@ export class WsDriver {
     this.send(msg);
   }
 
+  public sendFindMatch() {
+    const msg: ClientMessage = {
+      type: ClientMessageType.FindMatch,
+    };
+    this.send(msg);
+  }
+
+  public sendReconnect(code: string, token: string) {
+    const msg: ClientMessage = {
+      type: ClientMessageType.Reconnect,
+      roomCode: code,
+      token: token,
+    };
+    this.send(msg);
+  }
+
+  public sendSpectate(code: string) {
+    const msg: ClientMessage = {
+      type: ClientMessageType.Spectate,
+      roomCode: code,
+    };
+    this.send(msg);
+  }
+
+  public sendRematch() {
+    const msg: ClientMessage = {
+      type: ClientMessageType.Rematch,
+    };
+    this.send(msg);
+  }
+
+  public sendPlayBot() {
+    const msg: ClientMessage = {
+      type: ClientMessageType.PlayBot,
+    };
+    this.send(msg);
+  }
+
   public sendActions(actions: TankAction[]) {
     const msg: ClientMessage = {
       type: ClientMessageType.SendTurn,